@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"dsn/core/config"
+	"dsn/core/keyring"
+	"dsn/core/services"
+)
+
+type command struct {
+	description string
+	run         func(ctx context.Context, args []string) error
+}
+
+// commands are one-off admin tasks, run as `dsn <command>` instead of starting the server
+var commands = map[string]command{
+	"sanitize-notes": {
+		description: "Re-sanitize the content of all stored notes and revisions",
+		run:         sanitizeNotesCommand,
+	},
+	"list-signing-keys": {
+		description: "List the keys session tokens are signed and validated with",
+		run:         listSigningKeysCommand,
+	},
+	"rotate-signing-key": {
+		description: "Sign new session tokens with a new key [HS256|EdDSA|ES256], keeping the old keys valid",
+		run:         rotateSigningKeyCommand,
+	},
+	"retire-signing-key": {
+		description: "Remove an old signing key <kid>, so the tokens it signed are refused",
+		run:         retireSigningKeyCommand,
+	},
+}
+
+func runCommand(ctx context.Context, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name, cmd := range commands {
+			names = append(names, fmt.Sprintf("  %s - %s", name, cmd.description))
+		}
+		slices.Sort(names)
+		return fmt.Errorf("unknown command '%s', available commands:\n%s", args[0], strings.Join(names, "\n"))
+	}
+
+	return cmd.run(ctx, args[1:])
+}
+
+func sanitizeNotesCommand(ctx context.Context, args []string) error {
+	changed, err := services.NewNoteService().SanitizeAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Sanitized %d notes and revisions", changed)
+	return nil
+}
+
+func listSigningKeysCommand(ctx context.Context, args []string) error {
+	keys, active := keyring.Default.Keys()
+	for _, key := range keys {
+		status := "validates"
+		if key.ID == active {
+			status = "active"
+		}
+		fmt.Printf("%s  %-5s  %s  %s\n", key.ID, key.Algorithm, key.CreatedAt.Format(time.RFC3339), status)
+	}
+	return nil
+}
+
+// rotateSigningKeyCommand makes a new key the active one. The old keys keep validating the tokens
+// they signed, so retire them once those have expired.
+func rotateSigningKeyCommand(ctx context.Context, args []string) error {
+	alg := config.JwtAlgorithm
+	if len(args) > 0 {
+		alg = args[0]
+	}
+
+	key, err := keyring.Default.Rotate(alg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("New tokens are signed with %s key %s", key.Algorithm, key.ID)
+	return nil
+}
+
+func retireSigningKeyCommand(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: dsn retire-signing-key <kid>")
+	}
+
+	if err := keyring.Default.Retire(args[0]); err != nil {
+		return err
+	}
+
+	log.Printf("Retired signing key %s", args[0])
+	return nil
+}
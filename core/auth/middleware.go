@@ -8,7 +8,10 @@ import (
 	"dsn/core/services"
 )
 
-func Middleware(authService *services.AuthService) func(http.Handler) http.Handler {
+// Middleware authenticates a request by session or personal access token and passes the user on
+// in the X-User-ID, X-Username, X-Is-Admin and X-Session-ID headers. An access token must grant
+// every one of scopes; a route given no scopes only takes sessions.
+func Middleware(authService *services.AuthService, scopes ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !config.NoAuthForUserZero {
@@ -18,14 +21,27 @@ func Middleware(authService *services.AuthService) func(http.Handler) http.Handl
 					return
 				}
 
+				if claims.AccessTokenID != 0 && len(scopes) == 0 {
+					http.Error(w, "Access tokens can't be used here", http.StatusForbidden)
+					return
+				}
+				for _, scope := range scopes {
+					if !claims.HasScope(scope) {
+						http.Error(w, "Token is missing the "+scope+" scope", http.StatusForbidden)
+						return
+					}
+				}
+
 				r.Header.Set("X-User-ID", strconv.Itoa(claims.UserID))
 				r.Header.Set("X-Username", claims.Username)
 				r.Header.Set("X-Is-Admin", strconv.FormatBool(claims.IsAdmin))
+				r.Header.Set("X-Session-ID", claims.ID)
 			} else {
 				// set default headers for no-auth mode
 				r.Header.Set("X-User-ID", "0")
 				r.Header.Set("X-Username", "noAuthUser")
 				r.Header.Set("X-Is-Admin", "true")
+				r.Header.Set("X-Session-ID", "")
 			}
 
 			next.ServeHTTP(w, r)
@@ -11,19 +11,24 @@ import (
 )
 
 var Port int
-var JwtSecret string
+var JwtAlgorithm string
 var DataDirectoryPath string
 var CorsBaseUrl string
 var DatabaseDirectory string
 var UploadsDirectory string
+var KeysDirectory string
 var NoAuthForUserZero bool
+var TrashRetentionDays int
+var RevisionLimit int
 
 var defaults = map[string]string{
 	"PORT":                  "8080",
 	"DATA_DIR_PATH":         "./data",
 	"CORS_BASE_URL":         "*",
-	"AUTH_ENCRYPTION_KEY":   "0123456789abcdef0123456789abcdef",
+	"JWT_ALGORITHM":         "HS256",
 	"NO_AUTH_FOR_USER_ZERO": "false",
+	"TRASH_RETENTION_DAYS":  "30",
+	"REVISION_LIMIT":        "500",
 }
 
 func LoadConfig() {
@@ -44,13 +49,29 @@ func LoadConfig() {
 		log.Println("*** CORS_BASE_URL environment variable is not set, allowing all origins")
 	}
 
-	JwtSecret = getEnv("AUTH_ENCRYPTION_KEY")
-	if JwtSecret == defaults["AUTH_ENCRYPTION_KEY"] {
-		log.Println("*** AUTH_ENCRYPTION_KEY environment variable is not set, using fallback key")
+	// the algorithm of new signing keys, unless rotate-signing-key is given another
+	JwtAlgorithm = getEnv("JWT_ALGORITHM")
+	if os.Getenv("AUTH_ENCRYPTION_KEY") != "" {
+		log.Println("*** AUTH_ENCRYPTION_KEY is no longer used, tokens are signed with the keys in DATA_DIR_PATH/keys, so everyone logs in again after upgrading")
 	}
 
 	UploadsDirectory = path.Join(DataDirectoryPath, "uploads")
 	DatabaseDirectory = path.Join(DataDirectoryPath, "database")
+	KeysDirectory = path.Join(DataDirectoryPath, "keys")
+
+	trashRetentionDays := getEnv("TRASH_RETENTION_DAYS")
+	TrashRetentionDays, err = strconv.Atoi(trashRetentionDays)
+	if err != nil || TrashRetentionDays < 0 {
+		log.Printf("*** Invalid TRASH_RETENTION_DAYS environment variable '%s', using default %s", trashRetentionDays, defaults["TRASH_RETENTION_DAYS"])
+		TrashRetentionDays, _ = strconv.Atoi(defaults["TRASH_RETENTION_DAYS"])
+	}
+
+	revisionLimit := getEnv("REVISION_LIMIT")
+	RevisionLimit, err = strconv.Atoi(revisionLimit)
+	if err != nil || RevisionLimit < 0 {
+		log.Printf("*** Invalid REVISION_LIMIT environment variable '%s', using default %s", revisionLimit, defaults["REVISION_LIMIT"])
+		RevisionLimit, _ = strconv.Atoi(defaults["REVISION_LIMIT"])
+	}
 
 	NoAuthForUserZero = getEnv("NO_AUTH_FOR_USER_ZERO") == "true"
 	if NoAuthForUserZero {
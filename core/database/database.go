@@ -5,12 +5,14 @@ import (
 	"database/sql"
 	"dsn/core/config"
 	"dsn/core/io"
+	"dsn/core/logic"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
-	_ "github.com/ncruces/go-sqlite3/driver"
+	"github.com/ncruces/go-sqlite3"
+	"github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 )
 
@@ -20,7 +22,9 @@ var err error
 
 func Initialise(ctx context.Context) {
 	openDatabase(ctx)
-	createTables(ctx)
+	if err := createTables(ctx); err != nil {
+		log.Fatalf("Failed to create tables: %v", err)
+	}
 }
 
 func openDatabase(ctx context.Context) {
@@ -34,7 +38,7 @@ func openDatabase(ctx context.Context) {
 
 	dataSource := fmt.Sprintf("file:%s?_journal_mode=WAL&_foreign_keys=on", dbFilePath)
 	var err error
-	DB, err = sql.Open("sqlite3", dataSource)
+	DB, err = driver.Open(dataSource, registerFunctions)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -45,6 +49,13 @@ func openDatabase(ctx context.Context) {
 	}
 }
 
+// registerFunctions adds the application functions used by queries and triggers to every connection.
+func registerFunctions(conn *sqlite3.Conn) error {
+	return conn.CreateFunction("html_to_text", 1, sqlite3.DETERMINISTIC|sqlite3.INNOCUOUS, func(ctx sqlite3.Context, arg ...sqlite3.Value) {
+		ctx.ResultText(logic.HTMLToText(arg[0].Text()))
+	})
+}
+
 func CleanShutdown() {
 	if DB != nil {
 		log.Println("Closing database...")
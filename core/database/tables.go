@@ -2,11 +2,26 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"log"
 
 	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 )
 
+// tagsTableDefinition is formatted with the table name, so the tags migration can build the new table alongside the old.
+const tagsTableDefinition = `
+	CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		parent_id INTEGER REFERENCES tags (id) ON DELETE SET NULL,
+		name TEXT NOT NULL,
+		color TEXT DEFAULT '#e0e0e0',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name),
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
 func createTables(ctx context.Context) error {
 	usersTable := `
 	CREATE TABLE IF NOT EXISTS users (
@@ -15,6 +30,9 @@ func createTables(ctx context.Context) error {
 		email TEXT UNIQUE NOT NULL,
 		password_hash TEXT NOT NULL,
 		is_admin BOOLEAN DEFAULT FALSE,
+		totp_secret TEXT NOT NULL DEFAULT '',
+		totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		totp_last_step INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
@@ -29,18 +47,18 @@ func createTables(ctx context.Context) error {
 		pinned BOOLEAN DEFAULT FALSE,
 		archived BOOLEAN DEFAULT FALSE,
 		order_position INTEGER DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 1,
+		kind TEXT NOT NULL DEFAULT 'text',
+		remind_at DATETIME,
+		recurrence TEXT NOT NULL DEFAULT '',
+		time_zone TEXT NOT NULL DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		deleted_at DATETIME,
 		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
 	);`
 
-	tagsTable := `
-	CREATE TABLE IF NOT EXISTS tags (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT UNIQUE NOT NULL,
-		color TEXT DEFAULT '#e0e0e0',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
+	tagsTable := fmt.Sprintf(tagsTableDefinition, "tags")
 
 	noteTagsTable := `
 	CREATE TABLE IF NOT EXISTS note_tags (
@@ -51,19 +69,220 @@ func createTables(ctx context.Context) error {
 		FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
 	);`
 
-	tables := []string{usersTable, notesTable, tagsTable, noteTagsTable}
+	noteRevisionsTable := `
+	CREATE TABLE IF NOT EXISTS note_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		note_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		revision INTEGER NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (note_id, revision),
+		FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	noteItemsTable := `
+	CREATE TABLE IF NOT EXISTS note_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		note_id INTEGER NOT NULL,
+		text TEXT NOT NULL DEFAULT '',
+		checked BOOLEAN NOT NULL DEFAULT FALSE,
+		position INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE
+	);`
+
+	// reminders that have fired and not yet been dismissed, at most one per note
+	dueRemindersTable := `
+	CREATE TABLE IF NOT EXISTS due_reminders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		note_id INTEGER NOT NULL UNIQUE,
+		user_id INTEGER NOT NULL,
+		due_at DATETIME NOT NULL,
+		fired_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	// rules go with the tags they use, so deleting a tag deletes its rules
+	noteRulesTable := `
+	CREATE TABLE IF NOT EXISTS note_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		match_field TEXT NOT NULL DEFAULT 'any',
+		match_type TEXT NOT NULL DEFAULT 'substring',
+		pattern TEXT NOT NULL DEFAULT '',
+		match_tag_id INTEGER REFERENCES tags (id) ON DELETE CASCADE,
+		match_color TEXT NOT NULL DEFAULT '',
+		add_tag_id INTEGER REFERENCES tags (id) ON DELETE CASCADE,
+		set_color TEXT NOT NULL DEFAULT '',
+		pin BOOLEAN NOT NULL DEFAULT FALSE,
+		archive BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	// saved searches, their filters are stored as json
+	collectionsTable := `
+	CREATE TABLE IF NOT EXISTS collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		query TEXT NOT NULL DEFAULT '',
+		filters TEXT NOT NULL DEFAULT '{}',
+		sort TEXT NOT NULL DEFAULT '',
+		direction TEXT NOT NULL DEFAULT '',
+		last_opened_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	// checklist items of a template are stored as json
+	noteTemplatesTable := `
+	CREATE TABLE IF NOT EXISTS note_templates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL DEFAULT '',
+		color TEXT NOT NULL DEFAULT '',
+		kind TEXT NOT NULL DEFAULT 'text',
+		items TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	// only the sha256 of a token is stored, scopes are space separated
+	accessTokensTable := `
+	CREATE TABLE IF NOT EXISTS access_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		prefix TEXT NOT NULL,
+		scopes TEXT NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	// only the sha256 of a recovery code is stored
+	recoveryCodesTable := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	// logins waiting for their second factor
+	pendingLoginsTable := `
+	CREATE TABLE IF NOT EXISTS pending_logins (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	settingsTable := `
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`
+
+	// a session is keyed by the jti of its token, which is only valid while the session exists
+	sessionsTable := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+	);`
+
+	// only the sha256 of a refresh token is stored. Spent tokens are kept to detect their reuse,
+	// until their session ends, along with their successor sealed with the spent token
+	refreshTokensTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		used_at DATETIME,
+		successor TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+	);`
+
+	tables := []string{usersTable, notesTable, tagsTable, noteTagsTable, noteRevisionsTable, noteItemsTable, dueRemindersTable, noteRulesTable, collectionsTable, noteTemplatesTable, accessTokensTable, recoveryCodesTable, pendingLoginsTable, settingsTable, sessionsTable, refreshTokensTable}
 	for _, table := range tables {
 		if _, err := DB.ExecContext(ctx, table); err != nil {
 			return err
 		}
 	}
 
+	// columns added after the original schema, applied to existing databases
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"notes", "deleted_at", "DATETIME"},
+		{"notes", "version", "INTEGER NOT NULL DEFAULT 1"},
+		{"notes", "kind", "TEXT NOT NULL DEFAULT 'text'"},
+		{"notes", "remind_at", "DATETIME"},
+		{"notes", "recurrence", "TEXT NOT NULL DEFAULT ''"},
+		{"notes", "time_zone", "TEXT NOT NULL DEFAULT ''"},
+		{"tags", "parent_id", "INTEGER REFERENCES tags (id) ON DELETE SET NULL"},
+		{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"refresh_tokens", "successor", "TEXT"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfNotExists(ctx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	if err := migrateTagOwners(ctx); err != nil {
+		return err
+	}
+
 	indexes := []string{
 		"CREATE INDEX IF NOT EXISTS idx_notes_user_id ON notes(user_id);",
 		"CREATE INDEX IF NOT EXISTS idx_notes_created_at ON notes(created_at);",
 		"CREATE INDEX IF NOT EXISTS idx_notes_pinned ON notes(pinned);",
 		"CREATE INDEX IF NOT EXISTS idx_notes_archived ON notes(archived);",
 		"CREATE INDEX IF NOT EXISTS idx_notes_order_position ON notes(order_position);",
+		"CREATE INDEX IF NOT EXISTS idx_notes_deleted_at ON notes(deleted_at);",
+		"CREATE INDEX IF NOT EXISTS idx_note_revisions_user_id ON note_revisions(user_id);",
+		"CREATE INDEX IF NOT EXISTS idx_note_items_note_id ON note_items(note_id, position);",
+		"CREATE INDEX IF NOT EXISTS idx_notes_remind_at ON notes(remind_at);",
+		"CREATE INDEX IF NOT EXISTS idx_due_reminders_user_id ON due_reminders(user_id);",
+		"CREATE INDEX IF NOT EXISTS idx_tags_parent_id ON tags(parent_id);",
+		"CREATE INDEX IF NOT EXISTS idx_note_tags_tag_id ON note_tags(tag_id);",
+		"CREATE INDEX IF NOT EXISTS idx_note_rules_user_id ON note_rules(user_id);",
+		"CREATE INDEX IF NOT EXISTS idx_collections_user_id ON collections(user_id);",
+		"CREATE INDEX IF NOT EXISTS idx_note_templates_user_id ON note_templates(user_id);",
+		"CREATE INDEX IF NOT EXISTS idx_access_tokens_user_id ON access_tokens(user_id);",
+		"CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id, code_hash);",
+		"CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);",
+		"CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);",
 	}
 
 	for _, index := range indexes {
@@ -72,5 +291,217 @@ func createTables(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	return createSearchIndex(ctx)
+}
+
+// searchBody is the indexed text of a note: the plain text of its content followed by its
+// checklist items. %[1]s names the notes row it is evaluated for.
+const searchBody = `html_to_text(%[1]s.content) || COALESCE(char(10) || (
+	SELECT group_concat(text, char(10)) FROM (
+		SELECT text FROM note_items WHERE note_id = %[1]s.id ORDER BY position
+	)
+), '')`
+
+// createSearchIndex sets up the full-text index of note titles and the plain text of their
+// content and items, kept in sync with the notes and note_items tables by triggers.
+func createSearchIndex(ctx context.Context) error {
+	reindexNote := func(noteID string) string {
+		return fmt.Sprintf(`UPDATE notes_fts SET body = (SELECT %s FROM notes WHERE id = %s) WHERE rowid = %s;`,
+			fmt.Sprintf(searchBody, "notes"), noteID, noteID)
+	}
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+			title,
+			body,
+			tokenize = 'unicode61 remove_diacritics 2'
+		);`,
+		// triggers are recreated on every start so databases pick up changes to their definitions
+		`DROP TRIGGER IF EXISTS notes_fts_insert;`,
+		`CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes BEGIN
+			INSERT INTO notes_fts (rowid, title, body) VALUES (new.id, new.title, ` + fmt.Sprintf(searchBody, "new") + `);
+		END;`,
+		`DROP TRIGGER IF EXISTS notes_fts_update;`,
+		`CREATE TRIGGER notes_fts_update AFTER UPDATE OF title, content ON notes BEGIN
+			UPDATE notes_fts SET title = new.title, body = ` + fmt.Sprintf(searchBody, "new") + ` WHERE rowid = new.id;
+		END;`,
+		`DROP TRIGGER IF EXISTS notes_fts_delete;`,
+		`CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes BEGIN
+			DELETE FROM notes_fts WHERE rowid = old.id;
+		END;`,
+		`DROP TRIGGER IF EXISTS note_items_fts_insert;`,
+		`CREATE TRIGGER note_items_fts_insert AFTER INSERT ON note_items BEGIN
+			` + reindexNote("new.note_id") + `
+		END;`,
+		`DROP TRIGGER IF EXISTS note_items_fts_update;`,
+		`CREATE TRIGGER note_items_fts_update AFTER UPDATE OF text, position ON note_items BEGIN
+			` + reindexNote("new.note_id") + `
+		END;`,
+		`DROP TRIGGER IF EXISTS note_items_fts_delete;`,
+		`CREATE TRIGGER note_items_fts_delete AFTER DELETE ON note_items BEGIN
+			` + reindexNote("old.note_id") + `
+		END;`,
+	}
+
+	for _, statement := range statements {
+		if _, err := DB.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	// notes written before the index existed are indexed on first start
+	var indexed, total int
+	err := DB.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM notes_fts), (SELECT COUNT(*) FROM notes)").Scan(&indexed, &total)
+	if err != nil {
+		return err
+	}
+	if indexed == total {
+		return nil
+	}
+
+	log.Printf("Rebuilding search index for %d notes", total)
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM notes_fts"); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO notes_fts (rowid, title, body) SELECT id, title, "+fmt.Sprintf(searchBody, "notes")+" FROM notes")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateTagOwners moves databases from one global tags table to tags owned by users. A tag goes to
+// every user whose notes use it, the first keeping the original and the others getting a copy, and
+// unused tags go to the first admin. The table is rebuilt because SQLite cannot drop the old UNIQUE (name).
+func migrateTagOwners(ctx context.Context) error {
+	var migrated int
+	err := DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('tags') WHERE name = 'user_id'").Scan(&migrated)
+	if err != nil || migrated > 0 {
+		return err
+	}
+
+	log.Println("Migrating tags to per-user tags")
+
+	// foreign keys are switched off for the rebuild, or dropping the old table would delete note_tags
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(tagsTableDefinition, "tags_new")); err != nil {
+		return err
+	}
+
+	type tagUser struct{ tagID, userID int }
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT nt.tag_id, n.user_id
+		FROM note_tags nt
+		JOIN notes n ON n.id = nt.note_id
+		ORDER BY nt.tag_id, n.user_id
+	`)
+	if err != nil {
+		return err
+	}
+	var uses []tagUser
+	for rows.Next() {
+		var use tagUser
+		if err := rows.Scan(&use.tagID, &use.userID); err != nil {
+			rows.Close()
+			return err
+		}
+		uses = append(uses, use)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// original ids are all taken before any copy is given a new one
+	var copies []tagUser
+	owned := make(map[int]bool)
+	for _, use := range uses {
+		if owned[use.tagID] {
+			copies = append(copies, use)
+			continue
+		}
+		owned[use.tagID] = true
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tags_new (id, user_id, name, color, created_at)
+			SELECT id, ?, name, color, created_at FROM tags WHERE id = ?
+		`, use.userID, use.tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tags_new (id, user_id, name, color, created_at)
+		SELECT t.id, u.id, t.name, t.color, t.created_at
+		FROM tags t, (SELECT id FROM users ORDER BY is_admin DESC, id LIMIT 1) u
+		WHERE t.id NOT IN (SELECT id FROM tags_new)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, use := range copies {
+		var copyID int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO tags_new (user_id, name, color, created_at)
+			SELECT ?, name, color, created_at FROM tags WHERE id = ?
+			RETURNING id
+		`, use.userID, use.tagID).Scan(&copyID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE note_tags SET tag_id = ?
+			WHERE tag_id = ? AND note_id IN (SELECT id FROM notes WHERE user_id = ?)
+		`, copyID, use.tagID, use.userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range []string{"DROP TABLE tags", "ALTER TABLE tags_new RENAME TO tags"} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func addColumnIfNotExists(ctx context.Context, table, column, definition string) error {
+	var count int
+	err := DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = DB.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
 }
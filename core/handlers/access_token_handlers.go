@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func GetAccessTokensHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tokens, err := authService.GetAccessTokens(ctx, userID)
+		if err != nil {
+			http.Error(w, "Failed to get access tokens", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
+
+// CreateAccessTokenHandler answers with the new token, which is the only time it is shown.
+func CreateAccessTokenHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		isAdmin, err := getIsAdminFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.CreateAccessTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := services.ValidateAccessTokenRequest(req, isAdmin, time.Now()); err != nil {
+			http.Error(w, "Invalid access token: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token, err := authService.CreateAccessToken(ctx, userID, req)
+		if err != nil {
+			http.Error(w, "Failed to create access token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+func RevokeAccessTokenHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tokenID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid access token ID", http.StatusBadRequest)
+			return
+		}
+
+		err = authService.RevokeAccessToken(ctx, tokenID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Access token not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to revoke access token", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
 	"dsn/core/services"
 	"dsn/core/types"
 )
 
-func RegisterHandler(userService *services.UserService, authService *services.AuthService) http.HandlerFunc {
+func RegisterHandler(userService *services.UserService, authService *services.AuthService, twoFactorService *services.TwoFactorService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req types.CreateUserRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -27,13 +30,13 @@ func RegisterHandler(userService *services.UserService, authService *services.Au
 			return
 		}
 
-		token, err := authService.GenerateToken(user.ID, user.Username, user.IsAdmin)
-		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		if challengeTwoFactor(w, r, twoFactorService, user.ID) {
 			return
 		}
 
-		authService.SetAuthCookie(w, token)
+		if !startSession(w, r, authService, user) {
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -41,7 +44,9 @@ func RegisterHandler(userService *services.UserService, authService *services.Au
 	}
 }
 
-func LoginHandler(userService *services.UserService, authService *services.AuthService) http.HandlerFunc {
+// LoginHandler logs the user in, or answers 202 with a TwoFactorChallenge when they still have
+// to pass a second factor at /api/login/2fa.
+func LoginHandler(userService *services.UserService, authService *services.AuthService, twoFactorService *services.TwoFactorService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req types.LoginRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -60,13 +65,85 @@ func LoginHandler(userService *services.UserService, authService *services.AuthS
 			return
 		}
 
-		token, err := authService.GenerateToken(user.ID, user.Username, user.IsAdmin)
+		if challengeTwoFactor(w, r, twoFactorService, user.ID) {
+			return
+		}
+
+		if !startSession(w, r, authService, user) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// challengeTwoFactor answers with a pending login when the user has to pass a second factor, and
+// reports whether it answered.
+func challengeTwoFactor(w http.ResponseWriter, r *http.Request, twoFactorService *services.TwoFactorService, userID int) bool {
+	ctx := r.Context()
+	needed, err := twoFactorService.NeedsTwoFactor(ctx, userID)
+	if err != nil {
+		log.Printf("Error checking two-factor authentication of user %d: %v", userID, err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return true
+	}
+	if !needed {
+		return false
+	}
+
+	challenge, err := twoFactorService.StartLogin(ctx, userID, time.Now())
+	if err != nil {
+		log.Printf("Error starting two-factor login of user %d: %v", userID, err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(challenge)
+	return true
+}
+
+// RefreshHandler rotates the refresh cookie and issues a new access token with the user's current
+// name and admin flag. A refresh token used twice revokes its session.
+func RefreshHandler(userService *services.UserService, authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("refresh_token")
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		refresh, err := authService.RotateRefreshToken(r.Context(), cookie.Value)
+		if errors.Is(err, services.ErrRefreshTokenReused) {
+			log.Printf("Refresh token reused from %s, revoked its session", r.RemoteAddr)
+		}
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			authService.ClearAuthCookie(w)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to refresh session", http.StatusInternalServerError)
+			return
+		}
+
+		user, err := userService.GetByID(refresh.UserID)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		token, err := authService.GenerateToken(refresh.SessionID, user.ID, user.Username, user.IsAdmin)
 		if err != nil {
 			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 			return
 		}
 
 		authService.SetAuthCookie(w, token)
+		authService.SetRefreshCookie(w, refresh.RefreshToken)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -74,23 +151,48 @@ func LoginHandler(userService *services.UserService, authService *services.AuthS
 	}
 }
 
-func LogoutHandler() http.HandlerFunc {
+// LogoutHandler revokes the session of the request, found by its access or refresh cookie, and
+// clears both cookies.
+func LogoutHandler(authService *services.AuthService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie := &http.Cookie{
-			Name:     "auth_token",
-			Value:    "",
-			Path:     "/",
-			MaxAge:   -1,
-			HttpOnly: true,
-			Secure:   false,
+		ctx := r.Context()
+		if claims, err := authService.GetUserFromRequest(r); err == nil && claims.ID != "" {
+			if err := authService.RevokeSession(ctx, claims.ID, claims.UserID); err != nil {
+				log.Printf("Error revoking session of user %d: %v", claims.UserID, err)
+			}
+		}
+		if cookie, err := r.Cookie("refresh_token"); err == nil {
+			if err := authService.RevokeRefreshToken(ctx, cookie.Value); err != nil {
+				log.Printf("Error revoking session: %v", err)
+			}
 		}
-		http.SetCookie(w, cookie)
+
+		authService.ClearAuthCookie(w)
 
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
 	}
 }
 
+// startSession logs the user in with new access and refresh cookies, and reports whether it could.
+func startSession(w http.ResponseWriter, r *http.Request, authService *services.AuthService, user *types.User) bool {
+	refresh, err := authService.CreateSession(r, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return false
+	}
+
+	token, err := authService.GenerateToken(refresh.SessionID, user.ID, user.Username, user.IsAdmin)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return false
+	}
+
+	authService.SetAuthCookie(w, token)
+	authService.SetRefreshCookie(w, refresh.RefreshToken)
+	return true
+}
+
 func CheckAuthHandler(userService *services.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := getUserIDFromRequest(r)
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func GetCollectionsHandler(collectionService *services.CollectionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		withUnread := r.URL.Query().Get("unread") == "true"
+		collections, err := collectionService.GetAll(ctx, userID, withUnread)
+		if err != nil {
+			http.Error(w, "Failed to get collections", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(collections)
+	}
+}
+
+func GetCollectionHandler(collectionService *services.CollectionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		collectionID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+			return
+		}
+
+		collection, err := collectionService.GetByID(ctx, collectionID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get collection", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(collection)
+	}
+}
+
+func CreateCollectionHandler(collectionService *services.CollectionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.CollectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := services.ValidateCollection(req); err != nil {
+			if !writeQueryError(w, err) {
+				http.Error(w, "Invalid collection: "+err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+
+		collection, err := collectionService.Create(ctx, userID, req)
+		if err != nil {
+			http.Error(w, "Failed to create collection", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(collection)
+	}
+}
+
+func UpdateCollectionHandler(collectionService *services.CollectionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		collectionID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.CollectionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := services.ValidateCollection(req); err != nil {
+			if !writeQueryError(w, err) {
+				http.Error(w, "Invalid collection: "+err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+
+		collection, err := collectionService.Update(ctx, collectionID, userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update collection", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(collection)
+	}
+}
+
+func DeleteCollectionHandler(collectionService *services.CollectionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		collectionID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+			return
+		}
+
+		err = collectionService.Delete(ctx, collectionID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetCollectionNotesHandler lists the notes of a saved search as they are now, taking only
+// limit and cursor from the request. Reading the first page marks the collection as opened.
+func GetCollectionNotesHandler(collectionService *services.CollectionService, noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		collectionID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+			return
+		}
+
+		requestOpts, err := parseNoteListOptions(r)
+		if err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		collection, err := collectionService.GetByID(ctx, collectionID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Collection not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get collection", http.StatusInternalServerError)
+			return
+		}
+
+		opts := services.CollectionListOptions(*collection, time.Now())
+		opts.Limit = requestOpts.Limit
+		opts.Cursor = requestOpts.Cursor
+
+		page, err := noteService.List(ctx, userID, opts)
+		if writeQueryError(w, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get notes", http.StatusInternalServerError)
+			return
+		}
+
+		if opts.Cursor == "" {
+			if err := collectionService.MarkOpened(ctx, collectionID, userID); err != nil {
+				log.Printf("Error marking collection %d as opened: %v", collectionID, err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+// GetSidebarHandler returns what the sidebar shows: the tag tree and the saved searches with
+// their unread counts unless unread=false.
+func GetSidebarHandler(tagService *services.TagService, collectionService *services.CollectionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tags, err := tagService.GetTree(userID)
+		if err != nil {
+			http.Error(w, "Failed to get tags", http.StatusInternalServerError)
+			return
+		}
+
+		withUnread := r.URL.Query().Get("unread") != "false"
+		collections, err := collectionService.GetAll(ctx, userID, withUnread)
+		if err != nil {
+			http.Error(w, "Failed to get collections", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.Sidebar{Tags: tags, Collections: collections})
+	}
+}
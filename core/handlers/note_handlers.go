@@ -5,6 +5,7 @@ import (
 	"dsn/core/services"
 	"dsn/core/types"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -25,8 +26,20 @@ func GetNotesHandler(noteService *services.NoteService) http.HandlerFunc {
 			return
 		}
 
-		includeArchived := r.URL.Query().Get("archived") == "true"
-		notes, err := noteService.GetByUserID(ctx, userID, includeArchived)
+		opts, err := parseNoteListOptions(r)
+		if err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := noteService.List(ctx, userID, opts)
+		if writeQueryError(w, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to get notes", http.StatusInternalServerError)
 			return
@@ -34,10 +47,103 @@ func GetNotesHandler(noteService *services.NoteService) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(notes)
+		json.NewEncoder(w).Encode(page)
 	}
 }
 
+const maxNotesPageSize = 500
+
+func parseNoteListOptions(r *http.Request) (types.NoteListOptions, error) {
+	query := r.URL.Query()
+	opts := types.NoteListOptions{
+		IncludeArchived: query.Get("archived") == "true",
+		ArchivedOnly:    query.Get("archived") == "only",
+		IncludeTrashed:  query.Get("trashed") == "true",
+		Color:           query.Get("color"),
+		Sort:            query.Get("sort"),
+		Direction:       query.Get("dir"),
+		Cursor:          query.Get("cursor"),
+		Query:           query.Get("q"),
+	}
+
+	if opts.Sort != "" && !services.IsValidNoteSort(opts.Sort) {
+		return opts, fmt.Errorf("unknown sort '%s'", opts.Sort)
+	}
+
+	if opts.Direction != "" && opts.Direction != "asc" && opts.Direction != "desc" {
+		return opts, fmt.Errorf("dir must be asc or desc")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		opts.Limit, err = strconv.Atoi(limit)
+		if err != nil || opts.Limit < 1 || opts.Limit > maxNotesPageSize {
+			return opts, fmt.Errorf("limit must be between 1 and %d", maxNotesPageSize)
+		}
+	}
+
+	if pinned := query.Get("pinned"); pinned != "" {
+		value, err := strconv.ParseBool(pinned)
+		if err != nil {
+			return opts, fmt.Errorf("pinned must be true or false")
+		}
+		opts.Pinned = &value
+	}
+
+	idLists := []struct {
+		param string
+		value *[]int
+	}{
+		{"tag", &opts.TagIDs},
+		{"tags", &opts.TagIDs},
+		{"exclude_tags", &opts.ExcludeTagIDs},
+	}
+	for _, list := range idLists {
+		for _, value := range query[list.param] {
+			ids, err := parseIDList(value)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be a comma separated list of tag ids", list.param)
+			}
+			*list.value = append(*list.value, ids...)
+		}
+	}
+
+	opts.TagsMode = query.Get("tags_mode")
+	if opts.TagsMode != "" && opts.TagsMode != services.TagsModeAll && opts.TagsMode != services.TagsModeAny {
+		return opts, fmt.Errorf("tags_mode must be all or any")
+	}
+
+	dateFilters := []struct {
+		param string
+		value **time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+		{"updated_after", &opts.UpdatedAfter},
+		{"updated_before", &opts.UpdatedBefore},
+	}
+	for _, filter := range dateFilters {
+		value := query.Get(filter.param)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseDateParam(value)
+		if err != nil {
+			return opts, fmt.Errorf("%s must be YYYY-MM-DD or RFC 3339", filter.param)
+		}
+		*filter.value = &parsed
+	}
+
+	return opts, nil
+}
+
+func parseDateParam(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
 func CreateNoteHandler(noteService *services.NoteService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -53,12 +159,35 @@ func CreateNoteHandler(noteService *services.NoteService) http.HandlerFunc {
 			return
 		}
 
+		if req.Kind != "" && !services.IsValidNoteKind(req.Kind) {
+			http.Error(w, "Invalid note kind", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Items) > 0 && req.Kind != types.NoteKindChecklist {
+			http.Error(w, "Only checklist notes can have items", http.StatusBadRequest)
+			return
+		}
+
+		for i := range req.Items {
+			req.Items[i].Text = strings.TrimSpace(req.Items[i].Text)
+			if req.Items[i].Text == "" {
+				http.Error(w, "Item text is required", http.StatusBadRequest)
+				return
+			}
+		}
+
 		note, err := noteService.Create(ctx, userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Template not found", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to create note", http.StatusInternalServerError)
 			return
 		}
 
+		setNoteETag(w, note)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(note)
@@ -80,12 +209,14 @@ func GetNoteHandler(noteService *services.NoteService) http.HandlerFunc {
 			return
 		}
 
-		note, err := noteService.GetByID(ctx, noteID, userID)
+		includeTrashed := r.URL.Query().Get("trashed") == "true"
+		note, err := noteService.GetByID(ctx, noteID, userID, includeTrashed)
 		if err != nil {
 			http.Error(w, "Note not found", http.StatusNotFound)
 			return
 		}
 
+		setNoteETag(w, note)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(note)
@@ -114,12 +245,27 @@ func UpdateNoteHandler(noteService *services.NoteService) http.HandlerFunc {
 			return
 		}
 
-		note, err := noteService.Update(ctx, noteID, userID, req)
+		expectedVersion, err := getIfMatchVersion(r)
+		if err != nil {
+			http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteService.Update(ctx, noteID, userID, req, expectedVersion)
+		if errors.Is(err, services.ErrVersionConflict) {
+			writeVersionConflict(w, r, noteService, noteID, userID)
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to update note", http.StatusInternalServerError)
 			return
 		}
 
+		setNoteETag(w, note)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(note)
@@ -142,6 +288,10 @@ func DeleteNoteHandler(noteService *services.NoteService) http.HandlerFunc {
 		}
 
 		err = noteService.Delete(ctx, noteID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to delete note", http.StatusInternalServerError)
 			return
@@ -151,6 +301,98 @@ func DeleteNoteHandler(noteService *services.NoteService) http.HandlerFunc {
 	}
 }
 
+func GetTrashHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		notes, err := noteService.GetTrash(ctx, userID)
+		if err != nil {
+			http.Error(w, "Failed to get trash", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(notes)
+	}
+}
+
+func RestoreNoteHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteService.Restore(ctx, noteID, userID)
+		if err != nil {
+			http.Error(w, "Note not found in trash", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(note)
+	}
+}
+
+func DeleteNotePermanentlyHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		err = noteService.DeletePermanently(ctx, noteID, userID)
+		if err != nil {
+			http.Error(w, "Note not found in trash", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func EmptyTrashHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		err = noteService.EmptyTrash(ctx, userID)
+		if err != nil {
+			http.Error(w, "Failed to empty trash", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 func SearchNotesHandler(noteService *services.NoteService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -166,7 +408,11 @@ func SearchNotesHandler(noteService *services.NoteService) http.HandlerFunc {
 			return
 		}
 
-		notes, err := noteService.Search(ctx, userID, query)
+		includeTrashed := r.URL.Query().Get("trashed") == "true"
+		notes, err := noteService.Search(ctx, userID, query, includeTrashed)
+		if writeQueryError(w, err) {
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to search notes", http.StatusInternalServerError)
 			return
@@ -199,12 +445,27 @@ func TogglePinHandler(noteService *services.NoteService) http.HandlerFunc {
 			return
 		}
 
-		note, err := noteService.TogglePin(ctx, noteID, userID, req.Pinned)
+		expectedVersion, err := getIfMatchVersion(r)
+		if err != nil {
+			http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteService.TogglePin(ctx, noteID, userID, req.Pinned, expectedVersion)
+		if errors.Is(err, services.ErrVersionConflict) {
+			writeVersionConflict(w, r, noteService, noteID, userID)
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to toggle pin status", http.StatusInternalServerError)
 			return
 		}
 
+		setNoteETag(w, note)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(note)
@@ -232,12 +493,27 @@ func ToggleArchiveHandler(noteService *services.NoteService) http.HandlerFunc {
 			return
 		}
 
-		note, err := noteService.ToggleArchive(ctx, noteID, userID, req.Archived)
+		expectedVersion, err := getIfMatchVersion(r)
+		if err != nil {
+			http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteService.ToggleArchive(ctx, noteID, userID, req.Archived, expectedVersion)
+		if errors.Is(err, services.ErrVersionConflict) {
+			writeVersionConflict(w, r, noteService, noteID, userID)
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to toggle archive status", http.StatusInternalServerError)
 			return
 		}
 
+		setNoteETag(w, note)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(note)
@@ -269,6 +545,109 @@ func UpdateNotesOrderHandler(noteService *services.NoteService) http.HandlerFunc
 	}
 }
 
+func DuplicateNoteHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteService.Duplicate(ctx, noteID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to duplicate note", http.StatusInternalServerError)
+			return
+		}
+
+		setNoteETag(w, note)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(note)
+	}
+}
+
+func BulkNotesHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.BulkNoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := services.ValidateBulkNoteRequest(req); err != nil {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := noteService.Bulk(ctx, userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update notes", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// setNoteETag exposes the note version so clients can make conditional writes with If-Match.
+func setNoteETag(w http.ResponseWriter, note *types.Note) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, note.Version))
+}
+
+// getIfMatchVersion returns the note version a request is conditional on,
+// or 0 when there is no If-Match header or it matches any version.
+func getIfMatchVersion(r *http.Request) (int, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(ifMatch, `"`))
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid If-Match header %q", ifMatch)
+	}
+
+	return version, nil
+}
+
+// writeVersionConflict answers a stale conditional write with the current server copy of the note.
+func writeVersionConflict(w http.ResponseWriter, r *http.Request, noteService *services.NoteService, noteID, userID int) {
+	note, err := noteService.GetByID(r.Context(), noteID, userID, false)
+	if err != nil {
+		http.Error(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	setNoteETag(w, note)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(note)
+}
+
 func UploadImageHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := getUserIDFromRequest(r)
@@ -322,3 +701,33 @@ func UploadImageHandler() http.HandlerFunc {
 		json.NewEncoder(w).Encode(map[string]string{"url": url})
 	}
 }
+
+func parseIDList(value string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("invalid id %q", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// writeQueryError answers 400 with the offending token when err is a *services.QueryError,
+// and reports whether it did.
+func writeQueryError(w http.ResponseWriter, err error) bool {
+	var queryErr *services.QueryError
+	if !errors.As(err, &queryErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":    queryErr.Message,
+		"token":    queryErr.Token,
+		"position": queryErr.Position,
+	})
+	return true
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func CreateNoteItemHandler(noteItemService *services.NoteItemService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.CreateNoteItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		req.Text = strings.TrimSpace(req.Text)
+		if req.Text == "" {
+			http.Error(w, "Item text is required", http.StatusBadRequest)
+			return
+		}
+
+		item, err := noteItemService.Create(ctx, noteID, userID, req)
+		if errors.Is(err, services.ErrNotChecklist) {
+			http.Error(w, "Note is not a checklist", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to create item", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+func UpdateNoteItemHandler(noteItemService *services.NoteItemService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.UpdateNoteItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Text != nil {
+			text := strings.TrimSpace(*req.Text)
+			if text == "" {
+				http.Error(w, "Item text is required", http.StatusBadRequest)
+				return
+			}
+			req.Text = &text
+		}
+
+		updateNoteItem(w, r, noteItemService, req)
+	}
+}
+
+func ToggleNoteItemHandler(noteItemService *services.NoteItemService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.ToggleNoteItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		updateNoteItem(w, r, noteItemService, types.UpdateNoteItemRequest{Checked: &req.Checked})
+	}
+}
+
+func updateNoteItem(w http.ResponseWriter, r *http.Request, noteItemService *services.NoteItemService, req types.UpdateNoteItemRequest) {
+	ctx := r.Context()
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	noteID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	itemID, err := strconv.Atoi(r.PathValue("itemId"))
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	item, err := noteItemService.Update(ctx, noteID, itemID, userID, req)
+	if errors.Is(err, services.ErrNotChecklist) {
+		http.Error(w, "Note is not a checklist", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update item", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+func UpdateNoteItemsOrderHandler(noteItemService *services.NoteItemService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		var itemOrders map[int]int
+		if err := json.NewDecoder(r.Body).Decode(&itemOrders); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		items, err := noteItemService.UpdateOrder(ctx, noteID, userID, itemOrders)
+		if errors.Is(err, services.ErrNotChecklist) {
+			http.Error(w, "Note is not a checklist", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update item order", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(items)
+	}
+}
+
+func DeleteNoteItemHandler(noteItemService *services.NoteItemService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		itemID, err := strconv.Atoi(r.PathValue("itemId"))
+		if err != nil {
+			http.Error(w, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		err = noteItemService.Delete(ctx, noteID, itemID, userID)
+		if errors.Is(err, services.ErrNotChecklist) {
+			http.Error(w, "Note is not a checklist", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete item", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ConvertNoteHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.ConvertNoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !services.IsValidNoteKind(req.Kind) {
+			http.Error(w, "Invalid note kind", http.StatusBadRequest)
+			return
+		}
+
+		expectedVersion, err := getIfMatchVersion(r)
+		if err != nil {
+			http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteService.Convert(ctx, noteID, userID, req.Kind, expectedVersion)
+		if errors.Is(err, services.ErrVersionConflict) {
+			writeVersionConflict(w, r, noteService, noteID, userID)
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to convert note", http.StatusInternalServerError)
+			return
+		}
+
+		setNoteETag(w, note)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(note)
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+func GetNoteRulesHandler(noteRuleService *services.NoteRuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rules, err := noteRuleService.GetAll(ctx, userID)
+		if err != nil {
+			http.Error(w, "Failed to get rules", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+func CreateNoteRuleHandler(noteRuleService *services.NoteRuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.NoteRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := services.ValidateNoteRule(&req); err != nil {
+			http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rule, err := noteRuleService.Create(ctx, userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to create rule", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+func UpdateNoteRuleHandler(noteRuleService *services.NoteRuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ruleID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.NoteRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := services.ValidateNoteRule(&req); err != nil {
+			http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := noteRuleService.GetByID(ctx, ruleID, userID); err != nil {
+			if errors.Is(err, services.ErrNotFound) {
+				http.Error(w, "Rule not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to update rule", http.StatusInternalServerError)
+			return
+		}
+
+		rule, err := noteRuleService.Update(ctx, ruleID, userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update rule", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rule)
+	}
+}
+
+func DeleteNoteRuleHandler(noteRuleService *services.NoteRuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ruleID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		err = noteRuleService.Delete(ctx, ruleID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete rule", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ApplyNoteRuleHandler(noteRuleService *services.NoteRuleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ruleID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		noteIDs, err := noteRuleService.Apply(ctx, ruleID, userID, dryRun)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to apply rule", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.ApplyNoteRuleResult{DryRun: dryRun, NoteIDs: noteIDs})
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"dsn/core/logic"
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultUpcomingReminderDays = 7
+	maxUpcomingReminderDays     = 366
+)
+
+func SetNoteReminderHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.SetReminderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.RemindAt.IsZero() {
+			http.Error(w, "remind_at is required", http.StatusBadRequest)
+			return
+		}
+
+		if req.Recurrence != "" {
+			if _, err := logic.ParseRecurrence(req.Recurrence); err != nil {
+				http.Error(w, "Invalid recurrence: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if req.TimeZone != "" {
+			if _, err := logic.LoadTimeZone(req.TimeZone); err != nil {
+				http.Error(w, "Invalid time_zone: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		note, err := noteService.SetReminder(ctx, noteID, userID, req.RemindAt, req.Recurrence, req.TimeZone)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to set reminder", http.StatusInternalServerError)
+			return
+		}
+
+		setNoteETag(w, note)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(note)
+	}
+}
+
+func ClearNoteReminderHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		note, err := noteService.ClearReminder(ctx, noteID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to clear reminder", http.StatusInternalServerError)
+			return
+		}
+
+		setNoteETag(w, note)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(note)
+	}
+}
+
+func GetUpcomingRemindersHandler(noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		days := defaultUpcomingReminderDays
+		if value := r.URL.Query().Get("days"); value != "" {
+			days, err = strconv.Atoi(value)
+			if err != nil || days < 1 || days > maxUpcomingReminderDays {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+		}
+
+		notes, err := noteService.UpcomingReminders(ctx, userID, time.Now().AddDate(0, 0, days))
+		if err != nil {
+			http.Error(w, "Failed to get upcoming reminders", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(notes)
+	}
+}
+
+func GetDueRemindersHandler(reminderService *services.ReminderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		afterID := 0
+		if value := r.URL.Query().Get("after"); value != "" {
+			afterID, err = strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "Invalid after", http.StatusBadRequest)
+				return
+			}
+		}
+
+		reminders, err := reminderService.GetDue(ctx, userID, afterID)
+		if err != nil {
+			http.Error(w, "Failed to get due reminders", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(reminders)
+	}
+}
+
+func DismissReminderHandler(reminderService *services.ReminderService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reminderID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid reminder ID", http.StatusBadRequest)
+			return
+		}
+
+		err = reminderService.Dismiss(ctx, reminderID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Reminder not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to dismiss reminder", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
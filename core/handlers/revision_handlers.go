@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+func GetNoteRevisionsHandler(revisionService *services.RevisionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		revisions, err := revisionService.GetByNoteID(ctx, noteID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get note revisions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(revisions)
+	}
+}
+
+func GetNoteRevisionHandler(revisionService *services.RevisionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		revisionNumber, err := strconv.Atoi(r.PathValue("rev"))
+		if err != nil {
+			http.Error(w, "Invalid revision", http.StatusBadRequest)
+			return
+		}
+
+		revision, err := revisionService.Get(ctx, noteID, userID, revisionNumber)
+		if err != nil {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(revision)
+	}
+}
+
+func DiffNoteRevisionsHandler(revisionService *services.RevisionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		from, err := strconv.Atoi(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "Invalid from revision", http.StatusBadRequest)
+			return
+		}
+
+		to, err := strconv.Atoi(r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "Invalid to revision", http.StatusBadRequest)
+			return
+		}
+
+		diff, err := revisionService.Diff(ctx, noteID, userID, from, to)
+		if err != nil {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(diff)
+	}
+}
+
+func RestoreNoteRevisionHandler(revisionService *services.RevisionService, noteService *services.NoteService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		noteID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid note ID", http.StatusBadRequest)
+			return
+		}
+
+		revisionNumber, err := strconv.Atoi(r.PathValue("rev"))
+		if err != nil {
+			http.Error(w, "Invalid revision", http.StatusBadRequest)
+			return
+		}
+
+		revision, err := revisionService.Get(ctx, noteID, userID, revisionNumber)
+		if err != nil {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+
+		// restoring is an ordinary update, so it is recorded as a new revision
+		note, err := noteService.Update(ctx, noteID, userID, types.UpdateNoteRequest{
+			Title:   &revision.Title,
+			Content: &revision.Content,
+		}, 0)
+		if err != nil {
+			http.Error(w, "Failed to restore note revision", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(note)
+	}
+}
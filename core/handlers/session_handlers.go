@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+func GetSessionsHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		sessions, err := authService.GetSessions(ctx, userID, getSessionIDFromRequest(r))
+		if err != nil {
+			http.Error(w, "Failed to get sessions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// RevokeSessionHandler logs one of the user's devices out. Revoking the current session also
+// clears its cookie.
+func RevokeSessionHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		sessionID := r.PathValue("id")
+		err = authService.RevokeSession(ctx, sessionID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+
+		if sessionID == getSessionIDFromRequest(r) {
+			authService.ClearAuthCookie(w)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RevokeSessionsHandler logs all of the user's devices out, or all but the current one when
+// except_current=true.
+func RevokeSessionsHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		exceptCurrent := r.URL.Query().Get("except_current") == "true"
+		exceptID := ""
+		if exceptCurrent {
+			exceptID = getSessionIDFromRequest(r)
+		}
+
+		revoked, err := authService.RevokeSessions(ctx, userID, exceptID)
+		if err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+
+		if !exceptCurrent {
+			authService.ClearAuthCookie(w)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RevokeSessionsResult{Revoked: revoked})
+	}
+}
+
+func GetUserSessionsHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		isAdmin, err := getIsAdminFromRequest(r)
+		if err != nil || !isAdmin {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+
+		userID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		sessions, err := authService.GetSessions(ctx, userID, "")
+		if err != nil {
+			http.Error(w, "Failed to get sessions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// RevokeUserSessionsHandler lets an admin log all of a user's devices out.
+func RevokeUserSessionsHandler(authService *services.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		isAdmin, err := getIsAdminFromRequest(r)
+		if err != nil || !isAdmin {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+
+		userID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		revoked, err := authService.RevokeSessions(ctx, userID, "")
+		if err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RevokeSessionsResult{Revoked: revoked})
+	}
+}
+
+// getSessionIDFromRequest returns the jti of the session the middleware authenticated, which is
+// empty for a personal access token.
+func getSessionIDFromRequest(r *http.Request) string {
+	return r.Header.Get("X-Session-ID")
+}
@@ -4,18 +4,86 @@ import (
 	"dsn/core/services"
 	"dsn/core/types"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func GetTagsHandler(tagService *services.TagService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tags, err := tagService.GetAll()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tags, err := tagService.GetAll(userID)
+		if err != nil {
+			http.Error(w, "Failed to get tags", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tags)
+	}
+}
+
+func GetTagTreeHandler(tagService *services.TagService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tree, err := tagService.GetTree(userID)
 		if err != nil {
 			http.Error(w, "Failed to get tags", http.StatusInternalServerError)
 			return
 		}
 
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tree)
+	}
+}
+
+func GetUnusedTagsHandler(tagService *services.TagService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tags, err := tagService.GetUnused(userID)
+		if err != nil {
+			http.Error(w, "Failed to get unused tags", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tags)
+	}
+}
+
+func DeleteUnusedTagsHandler(tagService *services.TagService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tags, err := tagService.DeleteUnused(userID)
+		if err != nil {
+			http.Error(w, "Failed to delete unused tags", http.StatusInternalServerError)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(tags)
@@ -24,6 +92,12 @@ func GetTagsHandler(tagService *services.TagService) http.HandlerFunc {
 
 func CreateTagHandler(tagService *services.TagService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		var req types.CreateTagRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -35,7 +109,15 @@ func CreateTagHandler(tagService *services.TagService) http.HandlerFunc {
 			return
 		}
 
-		tag, err := tagService.Create(req)
+		tag, err := tagService.Create(userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Parent tag not found", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrTagExists) {
+			http.Error(w, "Tag already exists", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to create tag", http.StatusInternalServerError)
 			return
@@ -49,6 +131,12 @@ func CreateTagHandler(tagService *services.TagService) http.HandlerFunc {
 
 func UpdateTagHandler(tagService *services.TagService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		tagID, err := strconv.Atoi(r.PathValue("id"))
 		if err != nil {
 			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
@@ -61,7 +149,15 @@ func UpdateTagHandler(tagService *services.TagService) http.HandlerFunc {
 			return
 		}
 
-		tag, err := tagService.Update(tagID, req)
+		tag, err := tagService.Update(tagID, userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrTagExists) {
+			http.Error(w, "Tag already exists", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to update tag", http.StatusInternalServerError)
 			return
@@ -73,15 +169,160 @@ func UpdateTagHandler(tagService *services.TagService) http.HandlerFunc {
 	}
 }
 
+func MoveTagHandler(tagService *services.TagService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tagID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.MoveTagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tag, err := tagService.Move(tagID, userID, req.ParentID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrTagCycle) {
+			http.Error(w, "Tag can't be moved under its own subtree", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to move tag", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tag)
+	}
+}
+
+func MergeTagsHandler(tagService *services.TagService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tagID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.MergeTagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.SourceIDs) == 0 {
+			http.Error(w, "source_ids is required", http.StatusBadRequest)
+			return
+		}
+
+		tag, err := tagService.Merge(tagID, userID, req.SourceIDs)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to merge tags", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tag)
+	}
+}
+
+func BulkTagNotesHandler(tagService *services.TagService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tagID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+			return
+		}
+
+		var req types.BulkTagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Action != services.BulkTagAdd && req.Action != services.BulkTagRemove {
+			http.Error(w, "Action must be add or remove", http.StatusBadRequest)
+			return
+		}
+
+		if (len(req.NoteIDs) == 0) == (req.Query == "") {
+			http.Error(w, "Exactly one of note_ids or query is required", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := tagService.BulkUpdate(tagID, userID, req)
+		if writeQueryError(w, err) {
+			return
+		}
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note or tag not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update notes", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.BulkTagResult{Updated: updated})
+	}
+}
+
 func DeleteTagHandler(tagService *services.TagService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		tagID, err := strconv.Atoi(r.PathValue("id"))
 		if err != nil {
 			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
 			return
 		}
 
-		err = tagService.Delete(tagID)
+		err = tagService.Delete(tagID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		var inUse *services.TagInUseError
+		if errors.As(err, &inUse) {
+			http.Error(w, "Tag is used by rules, change or delete them first: "+strings.Join(inUse.Rules, ", "), http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
 			return
@@ -93,6 +334,12 @@ func DeleteTagHandler(tagService *services.TagService) http.HandlerFunc {
 
 func AssignTagToNoteHandler(tagService *services.TagService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		noteID, err := strconv.Atoi(r.PathValue("noteId"))
 		if err != nil {
 			http.Error(w, "Invalid note ID", http.StatusBadRequest)
@@ -105,7 +352,11 @@ func AssignTagToNoteHandler(tagService *services.TagService) http.HandlerFunc {
 			return
 		}
 
-		err = tagService.AssignToNote(noteID, tagID)
+		err = tagService.AssignToNote(noteID, tagID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note or tag not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to assign tag to note", http.StatusInternalServerError)
 			return
@@ -117,6 +368,12 @@ func AssignTagToNoteHandler(tagService *services.TagService) http.HandlerFunc {
 
 func RemoveTagFromNoteHandler(tagService *services.TagService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		noteID, err := strconv.Atoi(r.PathValue("noteId"))
 		if err != nil {
 			http.Error(w, "Invalid note ID", http.StatusBadRequest)
@@ -129,7 +386,11 @@ func RemoveTagFromNoteHandler(tagService *services.TagService) http.HandlerFunc
 			return
 		}
 
-		err = tagService.RemoveFromNote(noteID, tagID)
+		err = tagService.RemoveFromNote(noteID, tagID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note or tag not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to remove tag from note", http.StatusInternalServerError)
 			return
@@ -141,6 +402,12 @@ func RemoveTagFromNoteHandler(tagService *services.TagService) http.HandlerFunc
 
 func SetNoteTagsHandler(tagService *services.TagService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		noteID, err := strconv.Atoi(r.PathValue("id"))
 		if err != nil {
 			http.Error(w, "Invalid note ID", http.StatusBadRequest)
@@ -153,7 +420,11 @@ func SetNoteTagsHandler(tagService *services.TagService) http.HandlerFunc {
 			return
 		}
 
-		err = tagService.SetNoteTags(noteID, req.TagIDs)
+		err = tagService.SetNoteTags(noteID, userID, req.TagIDs)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Note or tag not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to set note tags", http.StatusInternalServerError)
 			return
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func GetTemplatesHandler(templateService *services.TemplateService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		templates, err := templateService.GetAll(ctx, userID)
+		if err != nil {
+			http.Error(w, "Failed to get templates", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(templates)
+	}
+}
+
+func GetTemplateHandler(templateService *services.TemplateService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		templateID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid template ID", http.StatusBadRequest)
+			return
+		}
+
+		template, err := templateService.GetByID(ctx, templateID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to get template", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(template)
+	}
+}
+
+func CreateTemplateHandler(templateService *services.TemplateService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, ok := decodeTemplateRequest(w, r)
+		if !ok {
+			return
+		}
+
+		template, err := templateService.Create(ctx, userID, req)
+		if err != nil {
+			http.Error(w, "Failed to create template", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(template)
+	}
+}
+
+func UpdateTemplateHandler(templateService *services.TemplateService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		templateID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid template ID", http.StatusBadRequest)
+			return
+		}
+
+		req, ok := decodeTemplateRequest(w, r)
+		if !ok {
+			return
+		}
+
+		template, err := templateService.Update(ctx, templateID, userID, req)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to update template", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(template)
+	}
+}
+
+func DeleteTemplateHandler(templateService *services.TemplateService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		templateID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid template ID", http.StatusBadRequest)
+			return
+		}
+
+		err = templateService.Delete(ctx, templateID, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete template", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decodeTemplateRequest reads and checks a template from the request body, answering 400 and
+// returning false when it is not valid.
+func decodeTemplateRequest(w http.ResponseWriter, r *http.Request) (types.NoteTemplateRequest, bool) {
+	var req types.NoteTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Template name is required", http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Kind != "" && !services.IsValidNoteKind(req.Kind) {
+		http.Error(w, "Invalid note kind", http.StatusBadRequest)
+		return req, false
+	}
+
+	if len(req.Items) > 0 && req.Kind != types.NoteKindChecklist {
+		http.Error(w, "Only checklist templates can have items", http.StatusBadRequest)
+		return req, false
+	}
+
+	for i := range req.Items {
+		req.Items[i].Text = strings.TrimSpace(req.Items[i].Text)
+		if req.Items[i].Text == "" {
+			http.Error(w, "Item text is required", http.StatusBadRequest)
+			return req, false
+		}
+	}
+
+	return req, true
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"dsn/core/services"
+	"dsn/core/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TwoFactorLoginHandler completes a pending login with a TOTP code or a recovery code and sets
+// the session cookie. It also completes the enrollment of a user who had to enroll to log in.
+func TwoFactorLoginHandler(userService *services.UserService, authService *services.AuthService, twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var req types.TwoFactorLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		userID, recoveryCodes, err := twoFactorService.CompleteLogin(ctx, req.PendingToken, req.Code, time.Now())
+		if errors.Is(err, services.ErrInvalidPendingLogin) {
+			http.Error(w, "Login has expired, please log in again", http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidCode) {
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+
+		user, err := userService.GetByID(userID)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if !startSession(w, r, authService, user) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.TwoFactorLoginResult{User: *user, RecoveryCodes: recoveryCodes})
+	}
+}
+
+// EnrollPendingLoginHandler starts the enrollment of a user who can't log in until they have
+// set up two-factor authentication.
+func EnrollPendingLoginHandler(twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		var req types.PendingLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		enrollment, err := twoFactorService.EnrollPendingLogin(ctx, req.PendingToken, time.Now())
+		if errors.Is(err, services.ErrInvalidPendingLogin) {
+			http.Error(w, "Login has expired, please log in again", http.StatusUnauthorized)
+			return
+		}
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to enroll two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(enrollment)
+	}
+}
+
+func GetTwoFactorStatusHandler(twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		status, err := twoFactorService.Status(ctx, userID)
+		if err != nil {
+			http.Error(w, "Failed to get two-factor status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+func EnrollTwoFactorHandler(twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		enrollment, err := twoFactorService.Enroll(ctx, userID)
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to enroll two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(enrollment)
+	}
+}
+
+// ConfirmTwoFactorHandler enables two-factor authentication and answers with the recovery codes,
+// which are only shown this once.
+func ConfirmTwoFactorHandler(twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := twoFactorService.Confirm(ctx, userID, req.Code, time.Now())
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RecoveryCodes{RecoveryCodes: codes})
+	}
+}
+
+func DisableTwoFactorHandler(twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err = twoFactorService.Disable(ctx, userID, req.Code, time.Now())
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RegenerateRecoveryCodesHandler(twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := twoFactorService.RegenerateRecoveryCodes(ctx, userID, req.Code, time.Now())
+		if writeTwoFactorError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(types.RecoveryCodes{RecoveryCodes: codes})
+	}
+}
+
+// ResetUserTwoFactorHandler lets an admin turn off two-factor authentication for a user who
+// has lost their authenticator and recovery codes.
+func ResetUserTwoFactorHandler(twoFactorService *services.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		isAdmin, err := getIsAdminFromRequest(r)
+		if err != nil || !isAdmin {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+
+		userID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		err = twoFactorService.Reset(ctx, userID)
+		if errors.Is(err, services.ErrNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to reset two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeTwoFactorError answers the two-factor errors a request can run into, and reports whether
+// err was one of them.
+func writeTwoFactorError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrInvalidCode):
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+	case errors.Is(err, services.ErrTwoFactorEnabled):
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled):
+		http.Error(w, "Two-factor enrollment has not been started", http.StatusConflict)
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		http.Error(w, "Two-factor authentication is required by an admin", http.StatusForbidden)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,345 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"dsn/core/config"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The signing algorithms a key can use, named as in a token's alg header.
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmES256 = "ES256"
+)
+
+var Algorithms = []string{AlgorithmHS256, AlgorithmEdDSA, AlgorithmES256}
+
+var keysFile = "signing_keys.json"
+
+// Default is the keyring session tokens are signed with, loaded by Initialise.
+var Default *Keyring
+
+var (
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrActiveKey    = errors.New("the active signing key can't be retired")
+	ErrUnknownAlg   = errors.New("unknown signing algorithm")
+	ErrNoActiveKey  = errors.New("no active signing key")
+	errKeyMalformed = errors.New("malformed signing key")
+)
+
+// Key is a signing key as it is stored. Key holds the HMAC secret, or the PKCS #8 encoded private
+// key of an EdDSA or ES256 key.
+type Key struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	Key       []byte    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type keyringFile struct {
+	Active string `json:"active"`
+	Keys   []Key  `json:"keys"`
+}
+
+type parsedKey struct {
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// Keyring holds the keys tokens are signed and validated with. New tokens are signed with the
+// active key and carry its ID as their kid header, while the other keys still validate the tokens
+// they signed until they are retired. The keyring is read again whenever its file changes, so a
+// running server picks up keys rotated by an admin command.
+type Keyring struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	file    keyringFile
+	keys    map[string]parsedKey
+}
+
+// Initialise loads the keyring under the data directory, creating it with a new key of the
+// configured algorithm on first start.
+func Initialise() {
+	if err := os.MkdirAll(config.KeysDirectory, 0700); err != nil {
+		log.Fatalf("Failed to create keys directory: %v", err)
+	}
+
+	path := filepath.Join(config.KeysDirectory, keysFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Printf("Creating new %s signing key", config.JwtAlgorithm)
+		if err := create(path, config.JwtAlgorithm); err != nil {
+			log.Fatalf("Failed to create signing key: %v", err)
+		}
+	}
+
+	var err error
+	Default, err = Open(path)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+}
+
+// Open loads the keyring stored at path.
+func Open(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// NormaliseAlgorithm returns the algorithm alg names, ignoring case.
+func NormaliseAlgorithm(alg string) (string, error) {
+	for _, known := range Algorithms {
+		if strings.EqualFold(alg, known) {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("%w '%s', expected one of %s", ErrUnknownAlg, alg, strings.Join(Algorithms, ", "))
+}
+
+// SigningKey returns the ID, signing method and private key of the active key.
+func (k *Keyring) SigningKey() (string, jwt.SigningMethod, any, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.reloadIfChanged()
+
+	key, ok := k.keys[k.file.Active]
+	if !ok {
+		return "", nil, nil, ErrNoActiveKey
+	}
+	return k.file.Active, key.method, key.sign, nil
+}
+
+// VerificationKey returns the key that validates a token with the given kid and alg headers. A key
+// only validates tokens of its own algorithm, so a token can't pick how it is checked.
+func (k *Keyring) VerificationKey(kid, alg string) (any, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.reloadIfChanged()
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownKey, kid)
+	}
+	if key.method.Alg() != alg {
+		return nil, fmt.Errorf("unexpected signing method %s for key '%s'", alg, kid)
+	}
+	return key.verify, nil
+}
+
+// Keys returns the stored keys, oldest first, and the ID of the active one.
+func (k *Keyring) Keys() ([]Key, string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.reloadIfChanged()
+
+	return slices.Clone(k.file.Keys), k.file.Active
+}
+
+// Rotate adds a new key of alg and makes it the active key. The previous keys keep validating the
+// tokens they signed until they are retired.
+func (k *Keyring) Rotate(alg string) (Key, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		return Key{}, err
+	}
+
+	key, err := generateKey(alg)
+	if err != nil {
+		return Key{}, err
+	}
+
+	file := keyringFile{Active: key.ID, Keys: append(slices.Clone(k.file.Keys), key)}
+	if err := writeFile(k.path, file); err != nil {
+		return Key{}, err
+	}
+	return key, k.reload()
+}
+
+// Retire removes a key that is no longer active, after which the tokens it signed are refused.
+func (k *Keyring) Retire(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.reload(); err != nil {
+		return err
+	}
+
+	if kid == k.file.Active {
+		return ErrActiveKey
+	}
+	index := slices.IndexFunc(k.file.Keys, func(key Key) bool { return key.ID == kid })
+	if index < 0 {
+		return fmt.Errorf("%w '%s'", ErrUnknownKey, kid)
+	}
+
+	file := keyringFile{Active: k.file.Active, Keys: slices.Delete(slices.Clone(k.file.Keys), index, index+1)}
+	if err := writeFile(k.path, file); err != nil {
+		return err
+	}
+	return k.reload()
+}
+
+// reloadIfChanged reads the keyring again if its file has changed. A file that can't be read is
+// logged and the keys already loaded stay in use.
+func (k *Keyring) reloadIfChanged() {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		log.Printf("Failed to check signing keys: %v", err)
+		return
+	}
+	if info.ModTime().Equal(k.modTime) {
+		return
+	}
+	if err := k.reload(); err != nil {
+		log.Printf("Failed to reload signing keys: %v", err)
+	}
+}
+
+func (k *Keyring) reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid keyring %s: %w", k.path, err)
+	}
+
+	keys := make(map[string]parsedKey, len(file.Keys))
+	for _, key := range file.Keys {
+		parsed, err := parseKey(key)
+		if err != nil {
+			return fmt.Errorf("key '%s': %w", key.ID, err)
+		}
+		keys[key.ID] = parsed
+	}
+	if _, ok := keys[file.Active]; !ok {
+		return ErrNoActiveKey
+	}
+
+	k.file = file
+	k.keys = keys
+	k.modTime = info.ModTime()
+	return nil
+}
+
+// create writes a keyring holding a single new key of alg.
+func create(path, alg string) error {
+	key, err := generateKey(alg)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, keyringFile{Active: key.ID, Keys: []Key{key}})
+}
+
+func generateKey(alg string) (Key, error) {
+	alg, err := NormaliseAlgorithm(alg)
+	if err != nil {
+		return Key{}, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+	key := Key{ID: hex.EncodeToString(id), Algorithm: alg, CreatedAt: time.Now().UTC()}
+
+	var private any
+	switch alg {
+	case AlgorithmHS256:
+		key.Key = make([]byte, 32)
+		if _, err := rand.Read(key.Key); err != nil {
+			return Key{}, err
+		}
+		return key, nil
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgorithmES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	key.Key, err = x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return Key{}, err
+	}
+	return key, nil
+}
+
+func parseKey(key Key) (parsedKey, error) {
+	if key.Algorithm == AlgorithmHS256 {
+		if len(key.Key) < 32 {
+			return parsedKey{}, errKeyMalformed
+		}
+		return parsedKey{method: jwt.SigningMethodHS256, sign: key.Key, verify: key.Key}, nil
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(key.Key)
+	if err != nil {
+		return parsedKey{}, fmt.Errorf("%w: %w", errKeyMalformed, err)
+	}
+
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		if key.Algorithm == AlgorithmEdDSA {
+			return parsedKey{method: jwt.SigningMethodEdDSA, sign: private, verify: private.Public()}, nil
+		}
+	case *ecdsa.PrivateKey:
+		if key.Algorithm == AlgorithmES256 && private.Curve == elliptic.P256() {
+			return parsedKey{method: jwt.SigningMethodES256, sign: private, verify: &private.PublicKey}, nil
+		}
+	}
+	return parsedKey{}, fmt.Errorf("%w: not an %s key", errKeyMalformed, key.Algorithm)
+}
+
+// writeFile replaces the keyring at path in one step, so a server reading it never sees half a file.
+func writeFile(path string, file keyringFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), keysFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
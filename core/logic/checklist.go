@@ -0,0 +1,125 @@
+package logic
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ChecklistLine is one item of a checklist converted to or from note content.
+type ChecklistLine struct {
+	Text    string
+	Checked bool
+}
+
+// tags that mark their text as done, as ChecklistToHTML writes checked items
+var struckTags = map[atom.Atom]bool{atom.S: true, atom.Strike: true, atom.Del: true}
+
+// HTMLToChecklist splits an html fragment into one line per block of text, dropping empty
+// ones. A line is checked when all its text is struck through or it starts with "[x]",
+// and list markers such as "- " or "[ ] " are removed.
+func HTMLToChecklist(fragment string) []ChecklistLine {
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+
+	var lines []ChecklistLine
+	var text strings.Builder
+	struck, plain := 0, 0
+	struckDepth := 0
+	inRawText := false
+
+	endLine := func() {
+		line := parseChecklistLine(text.String())
+		if line.Text != "" {
+			line.Checked = line.Checked || (struck > 0 && plain == 0)
+			lines = append(lines, line)
+		}
+		text.Reset()
+		struck, plain = 0, 0
+	}
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			endLine()
+			return lines
+		case html.TextToken:
+			if inRawText {
+				continue
+			}
+			// plain text with one item per line converts too
+			for i, part := range strings.Split(string(tokenizer.Text()), "\n") {
+				if i > 0 {
+					endLine()
+				}
+				text.WriteString(part)
+				if strings.TrimSpace(part) == "" {
+					continue
+				}
+				if struckDepth > 0 {
+					struck++
+				} else {
+					plain++
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := atom.Lookup(name)
+			switch {
+			case tag == atom.Script || tag == atom.Style:
+				inRawText = tokenType == html.StartTagToken
+			case struckTags[tag] && tokenType == html.StartTagToken:
+				struckDepth++
+			case struckTags[tag] && tokenType == html.EndTagToken && struckDepth > 0:
+				struckDepth--
+			case blockTags[tag]:
+				endLine()
+			}
+		}
+	}
+}
+
+func parseChecklistLine(text string) ChecklistLine {
+	text = strings.TrimSpace(text)
+
+	for _, marker := range []string{"[x]", "[X]"} {
+		if rest, ok := strings.CutPrefix(text, marker); ok {
+			return ChecklistLine{Text: strings.TrimSpace(rest), Checked: true}
+		}
+	}
+	if rest, ok := strings.CutPrefix(text, "[ ]"); ok {
+		return ChecklistLine{Text: strings.TrimSpace(rest)}
+	}
+	for _, marker := range []string{"- ", "* ", "• "} {
+		if rest, ok := strings.CutPrefix(text, marker); ok {
+			return parseChecklistLine(rest)
+		}
+	}
+
+	return ChecklistLine{Text: text}
+}
+
+// ChecklistToHTML renders checklist lines as a list, with checked items struck through.
+func ChecklistToHTML(lines []ChecklistLine) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	out.WriteString("<ul>")
+	for _, line := range lines {
+		out.WriteString("<li>")
+		if line.Checked {
+			out.WriteString("<s>")
+		}
+		out.WriteString(textEscaper.Replace(line.Text))
+		if line.Checked {
+			out.WriteString("</s>")
+		}
+		out.WriteString("</li>")
+	}
+	out.WriteString("</ul>")
+
+	return out.String()
+}
@@ -0,0 +1,253 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+// diffCostLimit bounds the edits middleSnake searches for before it settles for a split that may
+// not be on a shortest path, so diffing two unrelated long texts stays fast. The diff is still
+// correct, just not always minimal.
+const diffCostLimit = 1024
+
+type diffLine struct {
+	kind byte // ' ' unchanged, '-' removed, '+' added
+	text string
+	aPos int // lines of a consumed before this line
+	bPos int // lines of b consumed before this line
+}
+
+// UnifiedDiff returns a line based diff of a and b in unified format,
+// or an empty string when they are identical.
+func UnifiedDiff(fromName, toName, a, b string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	i := 0
+	for i < len(lines) {
+		for i < len(lines) && lines[i].kind == ' ' {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+
+		// extend the hunk while the next change is close enough to share context
+		end := i
+		for {
+			next := end + 1
+			for next < len(lines) && lines[next].kind == ' ' {
+				next++
+			}
+			if next < len(lines) && next-end-1 <= 2*diffContextLines {
+				end = next
+				continue
+			}
+			break
+		}
+
+		start := max(i-diffContextLines, 0)
+		stop := min(end+diffContextLines+1, len(lines))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, lines[start:stop])
+		i = stop
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, hunk []diffLine) {
+	aCount, bCount := 0, 0
+	for _, line := range hunk {
+		if line.kind != '+' {
+			aCount++
+		}
+		if line.kind != '-' {
+			bCount++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(hunk[0].aPos, aCount), hunkRange(hunk[0].bPos, bCount))
+	for _, line := range hunk {
+		out.WriteByte(line.kind)
+		out.WriteString(line.text)
+		out.WriteByte('\n')
+	}
+}
+
+func hunkRange(pos, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", pos)
+	case 1:
+		return fmt.Sprintf("%d", pos+1)
+	default:
+		return fmt.Sprintf("%d,%d", pos+1, count)
+	}
+}
+
+// diffLines builds an edit script of a and b with Myers' linear space algorithm, which takes
+// O((N+M)D) time and O(N+M) memory for N and M lines that differ in D of them.
+func diffLines(a, b []string) []diffLine {
+	d := &differ{
+		a:       a,
+		b:       b,
+		removed: make([]bool, len(a)),
+		added:   make([]bool, len(b)),
+	}
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d.forward = make([]int, size)
+	d.backward = make([]int, size)
+	d.compare(0, len(a), 0, len(b))
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.removed[i]:
+			lines = append(lines, diffLine{kind: '-', text: a[i], aPos: i, bPos: j})
+			i++
+		case j < len(b) && d.added[j]:
+			lines = append(lines, diffLine{kind: '+', text: b[j], aPos: i, bPos: j})
+			j++
+		default:
+			lines = append(lines, diffLine{kind: ' ', text: a[i], aPos: i, bPos: j})
+			i++
+			j++
+		}
+	}
+
+	return lines
+}
+
+// differ marks the lines of a that are removed and the lines of b that are added.
+type differ struct {
+	a, b           []string
+	removed, added []bool
+
+	// the furthest x reached on each diagonal, shared by every middleSnake call
+	forward, backward []int
+}
+
+// compare marks the edits between a[aLo:aHi] and b[bLo:bHi], splitting them on the middle snake
+// of a shortest edit path until one side is empty.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.added[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.removed[i] = true
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(u, aHi, v, bHi)
+	}
+}
+
+// middleSnake returns the start (x, y) and end (u, v) of the snake in the middle of a shortest
+// edit path from (aLo, bLo) to (aHi, bHi), found by searching from both ends until they meet.
+// The ranges must differ in their first and last lines.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+	forward, backward := d.forward, d.backward
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	for depth := 0; depth <= limit; depth++ {
+		for k := -depth; k <= depth; k += 2 {
+			var x int
+			if k == -depth || k != depth && forward[offset+k-1] < forward[offset+k+1] {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			// diagonal k of the forward search is diagonal delta-k of the backward one
+			if odd && delta-k >= -(depth-1) && delta-k <= depth-1 && x+backward[offset+delta-k] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		for k := -depth; k <= depth; k += 2 {
+			var x int
+			if k == -depth || k != depth && backward[offset+k-1] < backward[offset+k+1] {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			if !odd && delta-k >= -depth && delta-k <= depth && x+forward[offset+delta-k] >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+
+		if depth == diffCostLimit {
+			return d.furthestForward(aLo, bLo, n, m, depth)
+		}
+	}
+
+	// unreachable, the searches meet by the time they have each covered half the edits
+	panic("diff: no middle snake")
+}
+
+// furthestForward returns the point the forward search has got furthest to after depth edits,
+// which splits the ranges into two smaller ones without being on a shortest path.
+func (d *differ) furthestForward(aLo, bLo, n, m, depth int) (x, y, u, v int) {
+	offset := (n+m+1)/2 + 1
+	best := -1
+	for k := -depth; k <= depth; k += 2 {
+		fx := d.forward[offset+k]
+		fy := fx - k
+		if fx > n || fy < 0 || fy > m {
+			continue
+		}
+		if fx+fy > best {
+			best = fx + fy
+			x, y = fx, fy
+		}
+	}
+	return aLo + x, bLo + y, aLo + x, bLo + y
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
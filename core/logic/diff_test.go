@@ -0,0 +1,144 @@
+package logic
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	numbered := func(changes map[int]string) string {
+		var b strings.Builder
+		for i := 1; i <= 20; i++ {
+			if line, ok := changes[i]; ok {
+				b.WriteString(line + "\n")
+				continue
+			}
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"identical", "one\ntwo\n", "one\ntwo\n", ""},
+		{"both empty", "", "", ""},
+		{"changed line", "one\ntwo\nthree\n", "one\n2\nthree\n", "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"},
+		{"added to empty", "", "one\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+one\n"},
+		{"removed all", "one\ntwo\n", "", "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-one\n-two\n"},
+		{"missing final newline", "one\ntwo", "one\ntwo\n", ""},
+		{
+			"distant changes get their own hunks",
+			numbered(nil),
+			numbered(map[int]string{2: "X", 19: "Y"}),
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n@@ -16,5 +16,5 @@\n 16\n 17\n 18\n-19\n+Y\n 20\n",
+		},
+		{
+			"close changes share a hunk",
+			numbered(nil),
+			numbered(map[int]string{5: "X", 11: "Y"}),
+			"--- a\n+++ b\n@@ -2,13 +2,13 @@\n 2\n 3\n 4\n-5\n+X\n 6\n 7\n 8\n 9\n 10\n-11\n+Y\n 12\n 13\n 14\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("a", "b", tt.a, tt.b); got != tt.want {
+				t.Errorf("UnifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDiffLinesRandom checks that the edit script rebuilds both texts and is as short as the one
+// a longest common subsequence gives.
+func TestDiffLinesRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(25))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+
+	for range 5000 {
+		a, b := random(), random()
+		lines := diffLines(a, b)
+
+		var gotA, gotB []string
+		edits := 0
+		for _, line := range lines {
+			if line.kind != ' ' {
+				edits++
+			}
+			if line.kind != '+' {
+				if line.aPos != len(gotA) {
+					t.Fatalf("diffLines(%q, %q): line %q at aPos %d, want %d", a, b, line.text, line.aPos, len(gotA))
+				}
+				gotA = append(gotA, line.text)
+			}
+			if line.kind != '-' {
+				if line.bPos != len(gotB) {
+					t.Fatalf("diffLines(%q, %q): line %q at bPos %d, want %d", a, b, line.text, line.bPos, len(gotB))
+				}
+				gotB = append(gotB, line.text)
+			}
+		}
+
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) rebuilt %q, %q", a, b, gotA, gotB)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Fatalf("diffLines(%q, %q) made %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func lcsLength(a, b []string) int {
+	row := make([]int, len(b)+1)
+	for i := range a {
+		prev := 0
+		for j := range b {
+			current := row[j+1]
+			if a[i] == b[j] {
+				row[j+1] = prev + 1
+			} else {
+				row[j+1] = max(row[j+1], row[j])
+			}
+			prev = current
+		}
+	}
+	return row[len(b)]
+}
+
+// TestUnifiedDiffLargeNotes diffs notes whose LCS table would have needed gigabytes.
+func TestUnifiedDiffLargeNotes(t *testing.T) {
+	const size = 20000
+	var original, edited, rewritten strings.Builder
+	for i := range size {
+		fmt.Fprintf(&original, "line %d\n", i)
+		if i%100 == 0 {
+			fmt.Fprintf(&edited, "changed %d\n", i)
+		} else {
+			fmt.Fprintf(&edited, "line %d\n", i)
+		}
+		fmt.Fprintf(&rewritten, "other %d\n", i)
+	}
+
+	start := time.Now()
+	if got := strings.Count(UnifiedDiff("a", "b", original.String(), edited.String()), "\n+changed"); got != size/100 {
+		t.Errorf("edited diff adds %d lines, want %d", got, size/100)
+	}
+	if got := strings.Count(UnifiedDiff("a", "b", original.String(), rewritten.String()), "\n-line"); got != size {
+		t.Errorf("rewritten diff removes %d lines, want %d", got, size)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("diffing took %s", elapsed)
+	}
+}
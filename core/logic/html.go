@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// tags whose boundaries separate words, so "<p>a</p><p>b</p>" does not read as "ab"
+var blockTags = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Br: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.H1: true,
+	atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Section: true, atom.Table: true, atom.Td: true,
+	atom.Th: true, atom.Tr: true, atom.Ul: true,
+}
+
+// HTMLToText returns the readable text of an html fragment with markup removed and entities decoded.
+func HTMLToText(fragment string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+
+	var text strings.Builder
+	inRawText := false
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return strings.TrimSpace(text.String())
+		case html.TextToken:
+			if !inRawText {
+				text.Write(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := atom.Lookup(name)
+			if tag == atom.Script || tag == atom.Style {
+				// the tokenizer returns script and style bodies as text, which is not readable content
+				inRawText = tokenType == html.StartTagToken
+				continue
+			}
+			if blockTags[tag] {
+				text.WriteByte('\n')
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package logic
+
+import (
+	"regexp"
+	"time"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// PlaceholderValues returns the values of the template placeholders for a note created at now by username.
+func PlaceholderValues(now time.Time, username string) map[string]string {
+	return map[string]string{
+		"date":     now.Format(time.DateOnly),
+		"time":     now.Format("15:04"),
+		"weekday":  now.Weekday().String(),
+		"username": username,
+	}
+}
+
+// ExpandPlaceholders replaces each {{name}} in text with its value, leaving unknown names as they are.
+func ExpandPlaceholders(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
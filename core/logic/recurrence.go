@@ -0,0 +1,201 @@
+package logic
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "DAILY"
+	FrequencyWeekly  = "WEEKLY"
+	FrequencyMonthly = "MONTHLY"
+	FrequencyYearly  = "YEARLY"
+)
+
+var recurrenceAliases = map[string]string{
+	"daily":   "FREQ=DAILY",
+	"weekly":  "FREQ=WEEKLY",
+	"monthly": "FREQ=MONTHLY",
+	"yearly":  "FREQ=YEARLY",
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Recurrence is how a reminder repeats, parsed from the subset of RFC 5545 RRULE that
+// ParseRecurrence accepts. Occurrences are counted in the location of the time passed to
+// Next, so days and weekdays follow that zone's calendar.
+type Recurrence struct {
+	Frequency string
+	Interval  int
+	ByDay     []time.Weekday
+	Until     *time.Time
+
+	// an UNTIL without a trailing Z is a wall clock time in the occurrences' zone
+	untilLocal bool
+}
+
+// ParseRecurrence parses "daily", "weekly", "monthly", "yearly" or an RRULE such as
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;UNTIL=20271231T000000Z". BYDAY is only allowed
+// with FREQ=WEEKLY and takes plain weekdays.
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rule = strings.TrimSpace(rule)
+	if alias, ok := recurrenceAliases[strings.ToLower(rule)]; ok {
+		rule = alias
+	}
+	rule = strings.TrimPrefix(strings.ToUpper(rule), "RRULE:")
+
+	recurrence := &Recurrence{Interval: 1}
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%s is given more than once", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+				recurrence.Frequency = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > 1000 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			recurrence.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				if !slices.Contains(recurrence.ByDay, weekday) {
+					recurrence.ByDay = append(recurrence.ByDay, weekday)
+				}
+			}
+		case "UNTIL":
+			until, err := parseRRuleTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", value)
+			}
+			recurrence.Until = &until
+			recurrence.untilLocal = !strings.HasSuffix(value, "Z")
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+
+	if recurrence.Frequency == "" {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if len(recurrence.ByDay) > 0 && recurrence.Frequency != FrequencyWeekly {
+		return nil, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	}
+
+	return recurrence, nil
+}
+
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// Next returns the first occurrence after t, where t is itself an occurrence, and false once
+// the rule has ended. Dates that do not exist in a month, like the 31st, are skipped as RFC 5545 does.
+func (r *Recurrence) Next(t time.Time) (time.Time, bool) {
+	var next time.Time
+
+	switch r.Frequency {
+	case FrequencyDaily:
+		next = t.AddDate(0, 0, r.Interval)
+	case FrequencyWeekly:
+		next = r.nextWeekly(t)
+	case FrequencyMonthly, FrequencyYearly:
+		months := r.Interval
+		if r.Frequency == FrequencyYearly {
+			months *= 12
+		}
+		// a day missing from a month is skipped rather than moved, so the 31st stays the 31st
+		for step := months; ; step += months {
+			next = addMonths(t, step)
+			if next.Day() == t.Day() {
+				break
+			}
+		}
+	}
+
+	if r.Until != nil && next.After(r.until(next.Location())) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (r *Recurrence) until(location *time.Location) time.Time {
+	if !r.untilLocal {
+		return *r.Until
+	}
+	u := *r.Until
+	return time.Date(u.Year(), u.Month(), u.Day(), u.Hour(), u.Minute(), u.Second(), 0, location)
+}
+
+// LoadTimeZone returns the location of an IANA time zone name such as "Europe/London". An empty
+// name is UTC, and "Local" is refused since it would be the server's own zone.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// NextAfter returns the first occurrence later than after, skipping any that were missed.
+func (r *Recurrence) NextAfter(t, after time.Time) (time.Time, bool) {
+	for !t.After(after) {
+		var ok bool
+		if t, ok = r.Next(t); !ok {
+			return time.Time{}, false
+		}
+	}
+	return t, true
+}
+
+func (r *Recurrence) nextWeekly(t time.Time) time.Time {
+	if len(r.ByDay) == 0 {
+		return t.AddDate(0, 0, 7*r.Interval)
+	}
+
+	weekStart := startOfWeek(t)
+	for day := t.AddDate(0, 0, 1); ; day = day.AddDate(0, 0, 1) {
+		weeks := int(startOfWeek(day).Sub(weekStart).Hours()/24+0.5) / 7
+		if weeks%r.Interval == 0 && slices.Contains(r.ByDay, day.Weekday()) {
+			return day
+		}
+	}
+}
+
+// startOfWeek returns midnight on the Monday of t's week, the RRULE default WKST.
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	return time.Date(t.Year(), t.Month()+time.Month(months), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
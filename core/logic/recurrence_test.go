@@ -0,0 +1,107 @@
+package logic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrenceNextInTimeZone(t *testing.T) {
+	newYork := mustLoadTimeZone(t, "America/New_York")
+	losAngeles := mustLoadTimeZone(t, "America/Los_Angeles")
+	london := mustLoadTimeZone(t, "Europe/London")
+
+	tests := []struct {
+		name string
+		rule string
+		from time.Time
+		want time.Time
+	}{
+		{
+			// 20:00 on a Monday in Los Angeles is already Tuesday in UTC
+			"weekday of the zone",
+			"FREQ=WEEKLY;BYDAY=MO",
+			time.Date(2026, 10, 19, 20, 0, 0, 0, losAngeles),
+			time.Date(2026, 10, 26, 20, 0, 0, 0, losAngeles),
+		},
+		{
+			"wall clock kept when daylight saving ends",
+			"FREQ=WEEKLY;BYDAY=MO,FR",
+			time.Date(2026, 10, 30, 9, 0, 0, 0, newYork),
+			time.Date(2026, 11, 2, 9, 0, 0, 0, newYork),
+		},
+		{
+			"wall clock kept when daylight saving starts",
+			"daily",
+			time.Date(2026, 3, 28, 9, 0, 0, 0, london),
+			time.Date(2026, 3, 29, 9, 0, 0, 0, london),
+		},
+		{
+			"monthly across daylight saving",
+			"monthly",
+			time.Date(2026, 10, 15, 9, 0, 0, 0, newYork),
+			time.Date(2026, 11, 15, 9, 0, 0, 0, newYork),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := recurrence.Next(tt.from)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, %v, want %s", tt.from, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceUntil(t *testing.T) {
+	newYork := mustLoadTimeZone(t, "America/New_York")
+	from := time.Date(2026, 11, 1, 9, 0, 0, 0, newYork)
+
+	tests := []struct {
+		name   string
+		rule   string
+		wantOK bool
+	}{
+		// the next occurrence is 09:00 in New York, 14:00 in UTC
+		{"local until is in the zone", "FREQ=DAILY;UNTIL=20261102T090000", true},
+		{"utc until", "FREQ=DAILY;UNTIL=20261102T090000Z", false},
+		{"date until", "FREQ=DAILY;UNTIL=20261102", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := recurrence.Next(from); ok != tt.wantOK {
+				t.Errorf("Next(%s) ok = %v, want %v", from, ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadTimeZone(t *testing.T) {
+	for _, name := range []string{"Local", "Mars/Olympus_Mons", "+01:00"} {
+		if _, err := LoadTimeZone(name); err == nil {
+			t.Errorf("LoadTimeZone(%q) was accepted", name)
+		}
+	}
+	if location, err := LoadTimeZone(""); err != nil || location != time.UTC {
+		t.Errorf("LoadTimeZone(\"\") = %v, %v, want UTC", location, err)
+	}
+}
+
+func mustLoadTimeZone(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	location, err := LoadTimeZone(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
@@ -0,0 +1,276 @@
+package logic
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedTags maps the elements notes may contain to the attributes each may keep.
+var allowedTags = map[atom.Atom][]string{
+	atom.A:          {"href", "title"},
+	atom.B:          nil,
+	atom.Blockquote: nil,
+	atom.Br:         nil,
+	atom.Code:       nil,
+	atom.Del:        nil,
+	atom.Div:        nil,
+	atom.Em:         nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt", "title", "width", "height"},
+	atom.Ins:        nil,
+	atom.Li:         nil,
+	atom.Mark:       nil,
+	atom.Ol:         {"start"},
+	atom.P:          nil,
+	atom.Pre:        nil,
+	atom.S:          nil,
+	atom.Small:      nil,
+	atom.Span:       nil,
+	atom.Strike:     nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Th:         {"colspan", "rowspan"},
+	atom.Thead:      nil,
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+}
+
+// droppedWithContent are removed together with everything inside them, other
+// disallowed elements only lose their tags and keep their text.
+var droppedWithContent = map[atom.Atom]bool{
+	atom.Embed:    true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Iframe:   true,
+	atom.Math:     true,
+	atom.Noembed:  true,
+	atom.Noframes: true,
+	atom.Noscript: true,
+	atom.Object:   true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Svg:      true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Title:    true,
+	atom.Xmp:      true,
+}
+
+var allowedLinkSchemes = []string{"http", "https", "mailto"}
+
+// textEscaper escapes only what text needs, so quotes typed into a note come back unchanged.
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// uploadsPrefix is where uploaded images are served, the only allowed image source.
+const uploadsPrefix = "/uploads/"
+
+// SanitizeHTML reduces an html fragment to the allow-listed tags, attributes and URLs
+// notes may contain. The result is well formed, with stray end tags dropped and open ones closed.
+func SanitizeHTML(fragment string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+
+	var out strings.Builder
+	var open []atom.Atom
+	var dropping atom.Atom
+	dropDepth := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+
+		if dropDepth > 0 {
+			switch {
+			case tokenType == html.StartTagToken && token.DataAtom == dropping:
+				dropDepth++
+			case tokenType == html.EndTagToken && token.DataAtom == dropping:
+				dropDepth--
+			}
+			continue
+		}
+
+		switch tokenType {
+		case html.TextToken:
+			out.WriteString(textEscaper.Replace(token.Data))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedWithContent[token.DataAtom] {
+				if tokenType == html.StartTagToken {
+					dropping = token.DataAtom
+					dropDepth = 1
+				}
+				continue
+			}
+
+			allowedAttributes, ok := allowedTags[token.DataAtom]
+			if !ok {
+				continue
+			}
+
+			attributes, ok := sanitizeAttributes(token, allowedAttributes)
+			if !ok {
+				continue
+			}
+
+			out.WriteByte('<')
+			out.WriteString(token.DataAtom.String())
+			out.WriteString(attributes)
+			out.WriteByte('>')
+
+			if !isVoidElement(token.DataAtom) {
+				open = append(open, token.DataAtom)
+			}
+
+		case html.EndTagToken:
+			index := slices.Index(open, token.DataAtom)
+			if index < 0 {
+				continue
+			}
+			for i := len(open) - 1; i >= index; i-- {
+				writeEndTag(&out, open[i])
+			}
+			open = open[:index]
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		writeEndTag(&out, open[i])
+	}
+
+	return out.String()
+}
+
+// sanitizeAttributes renders the allowed attributes of token, reporting false when
+// the element is unusable without an attribute that was rejected.
+func sanitizeAttributes(token html.Token, allowed []string) (string, bool) {
+	var out strings.Builder
+	hasSource := false
+
+	for _, attribute := range token.Attr {
+		key := strings.ToLower(attribute.Key)
+		if attribute.Namespace != "" || !slices.Contains(allowed, key) {
+			continue
+		}
+
+		value := attribute.Val
+		switch key {
+		case "href":
+			var ok bool
+			if value, ok = sanitizeLink(value); !ok {
+				continue
+			}
+		case "src":
+			var ok bool
+			if value, ok = sanitizeImageSource(value); !ok {
+				continue
+			}
+			hasSource = true
+		case "width", "height", "colspan", "rowspan", "start":
+			if !isNumber(value) {
+				continue
+			}
+		}
+
+		out.WriteByte(' ')
+		out.WriteString(key)
+		out.WriteString(`="`)
+		out.WriteString(html.EscapeString(value))
+		out.WriteByte('"')
+	}
+
+	if token.DataAtom == atom.A && strings.Contains(out.String(), " href=") {
+		out.WriteString(` rel="noopener noreferrer nofollow"`)
+	}
+
+	if token.DataAtom == atom.Img && !hasSource {
+		return "", false
+	}
+
+	return out.String(), true
+}
+
+// sanitizeLink allows relative links and absolute ones with a safe scheme.
+func sanitizeLink(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+
+	parsed, err := url.Parse(withoutControlCharacters(value))
+	if err != nil {
+		return "", false
+	}
+
+	if parsed.Scheme != "" && !slices.Contains(allowedLinkSchemes, strings.ToLower(parsed.Scheme)) {
+		return "", false
+	}
+
+	return value, true
+}
+
+// sanitizeImageSource allows only images uploaded to this server.
+func sanitizeImageSource(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value != withoutControlCharacters(value) {
+		return "", false
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return "", false
+	}
+
+	if !strings.HasPrefix(parsed.Path, uploadsPrefix) || strings.Contains(parsed.Path, "..") {
+		return "", false
+	}
+
+	return value, true
+}
+
+// withoutControlCharacters removes the whitespace and control characters browsers
+// ignore inside URLs, so "java\tscript:" is seen as the scheme it really is.
+func withoutControlCharacters(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+func isNumber(value string) bool {
+	if value == "" || len(value) > 5 {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isVoidElement(tag atom.Atom) bool {
+	return tag == atom.Br || tag == atom.Hr || tag == atom.Img
+}
+
+func writeEndTag(out *strings.Builder, tag atom.Atom) {
+	out.WriteString("</")
+	out.WriteString(tag.String())
+	out.WriteByte('>')
+}
@@ -0,0 +1,80 @@
+package logic
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// links
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link with mixed case and leading space", `<a href=" JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link with a tab entity", `<a href="java&#x09;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link with a newline entity", `<a href="java&#10;script:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link with a control character", "<a href=\"\x01javascript:alert(1)\">x</a>", `<a>x</a>`},
+		{"javascript link with a hex entity", `<a href="&#x6A;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link with padded decimal entities", `<a href="&#0000106&#0000097&#0000118&#0000097&#0000115&#0000099&#0000114&#0000105&#0000112&#0000116&#0000058alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link with a named colon entity", `<a href="javascript&colon;alert(1)">x</a>`, `<a>x</a>`},
+		{"vbscript link", `<a href="vbscript:msgbox(1)">x</a>`, `<a>x</a>`},
+		{"data link", `<a href="data:text/html;base64,PHNjcmlwdD4=">x</a>`, `<a>x</a>`},
+		{"https link", `<a href="https://example.com/a?b=1&amp;c=2" target="_blank">ok</a>`, `<a href="https://example.com/a?b=1&amp;c=2" rel="noopener noreferrer nofollow">ok</a>`},
+		{"relative link", `<a href="/notes/1">rel</a>`, `<a href="/notes/1" rel="noopener noreferrer nofollow">rel</a>`},
+		{"mailto link", `<a href="mailto:a@example.com">m</a>`, `<a href="mailto:a@example.com" rel="noopener noreferrer nofollow">m</a>`},
+
+		// event handlers and styles
+		{"onclick", `<p onclick="alert(1)">x</p>`, `<p>x</p>`},
+		{"onerror and uppercase onload", `<img src="/uploads/a.png" onerror="alert(1)" ONLOAD="alert(1)">`, `<img src="/uploads/a.png">`},
+		{"onmouseover next to an allowed attribute", `<a href="#" onmouseover="alert(1)" title="t">x</a>`, `<a href="#" title="t" rel="noopener noreferrer nofollow">x</a>`},
+		{"quotes in an attribute can't break out", `<a title="&quot; onmouseover=&quot;alert(1)">x</a>`, `<a title="&#34; onmouseover=&#34;alert(1)">x</a>`},
+		{"style attribute", `<div style="background:url(javascript:alert(1))">x</div>`, `<div>x</div>`},
+
+		// foreign content
+		{"svg with a script", `<svg onload=alert(1)><script>alert(1)</script></svg>after`, `after`},
+		{"nested svg", `<svg><svg><script>alert(1)</script></svg><img src=x onerror=alert(1)></svg>after`, `after`},
+		{"math in svg", `<svg><math></svg><img src="/uploads/a.png" onerror=alert(1)>`, `<img src="/uploads/a.png">`},
+		{"svg in math", `<math><svg></math><img src="/uploads/a.png" onerror=alert(1)>`, `<img src="/uploads/a.png">`},
+		{"math mxss", `<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`, ``},
+		{"math with xlink", `<math><mi xlink:href="javascript:alert(1)">x</mi></math>after`, `after`},
+
+		// srcdoc
+		{"iframe srcdoc", `<iframe srcdoc="<script>alert(1)</script>"></iframe>after`, `after`},
+		{"srcdoc on an allowed element", `<p srcdoc="<script>alert(1)</script>">x</p>`, `<p>x</p>`},
+
+		// images
+		{"data image", `<img src="data:image/png;base64,iVBORw0KGgo=">`, ``},
+		{"off-origin image", `<img src="https://evil.example/uploads/a.png">`, ``},
+		{"protocol relative image", `<img src="//evil.example/uploads/a.png">`, ``},
+		{"image path traversal", `<img src="/uploads/../database/sqlite.db">`, ``},
+		{"image with a control character", "<img src=\"/uploads/\tx.png\">", ``},
+		{"uploaded image", `<img src="/uploads/1.png" alt="a" width="10" height="x">`, `<img src="/uploads/1.png" alt="a" width="10">`},
+
+		// style elements
+		{"style import", `<style>@import 'https://evil.example/x.css';</style>after`, `after`},
+		{"style inside a paragraph", `<p>before<style>p{color:red}</style>after</p>`, `<p>beforeafter</p>`},
+
+		// parser confusion
+		{"split script tag", `<scr<script>ipt>alert(1)</script>`, `ipt&gt;alert(1)`},
+		{"end tag in an attribute", `<p title="</p><script>alert(1)</script>">x</p>`, `<p>x</p>`},
+		{"end tag in an attribute inside noscript", `<noscript><p title="</noscript><img src=x onerror=alert(1)>">`, `"&gt;`},
+		{"comment", `<!--<img src=x onerror=alert(1)>-->after`, `after`},
+
+		// plain notes
+		{"text with entities and quotes", `<p>Tom & Jerry's "show"</p>`, `<p>Tom &amp; Jerry's "show"</p>`},
+		{"unclosed tags", `unclosed <b>bold <i>italic`, `unclosed <b>bold <i>italic</i></b>`},
+		{"stray end tag", `</p>stray<p>`, `stray<p></p>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeHTML(tt.in)
+			if got != tt.want {
+				t.Errorf("SanitizeHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if again := SanitizeHTML(got); again != got {
+				t.Errorf("not idempotent: %q became %q", got, again)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"dsn/core/types"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// scopes a personal access token can be given
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+	ScopeTagsWrite  = "tags:write"
+	ScopeAdmin      = "admin"
+)
+
+var accessTokenScopes = []string{ScopeNotesRead, ScopeNotesWrite, ScopeTagsWrite, ScopeAdmin}
+
+// accessTokenPrefix starts every personal access token, so they are easy to spot in scripts and logs.
+const accessTokenPrefix = "dsn_"
+
+// ValidateAccessTokenRequest checks a new token's name, scopes and expiry. Only admins can
+// create tokens with the admin scope.
+func ValidateAccessTokenRequest(req types.CreateAccessTokenRequest, isAdmin bool, now time.Time) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(accessTokenScopes, scope) {
+			return fmt.Errorf("unknown scope '%s'", scope)
+		}
+		if scope == ScopeAdmin && !isAdmin {
+			return fmt.Errorf("only admins can create tokens with the admin scope")
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+
+	return nil
+}
+
+// CreateAccessToken stores a new personal access token for the user and returns it with the
+// token itself, which can't be retrieved again.
+func (s *AuthService) CreateAccessToken(ctx context.Context, userID int, req types.CreateAccessTokenRequest) (*types.CreatedAccessToken, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	token := accessTokenPrefix + secret
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range accessTokenScopes {
+		if slices.Contains(req.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	var expiresAt any
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt.UTC().Format(sqliteTimeFormat)
+	}
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO access_tokens (user_id, name, token_hash, prefix, scopes, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, req.Name, hashToken(token), token[:len(accessTokenPrefix)+8], strings.Join(scopes, " "), expiresAt).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.queryAccessTokens(ctx, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.CreatedAccessToken{AccessToken: tokens[0], Token: token}, nil
+}
+
+// GetAccessTokens returns the user's personal access tokens, newest first, including expired ones.
+func (s *AuthService) GetAccessTokens(ctx context.Context, userID int) ([]types.AccessToken, error) {
+	return s.queryAccessTokens(ctx, "WHERE user_id = ? ORDER BY created_at DESC, id DESC", userID)
+}
+
+// RevokeAccessToken deletes one of the user's personal access tokens.
+func (s *AuthService) RevokeAccessToken(ctx context.Context, id, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM access_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("access token with id %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// validateAccessToken returns the claims of an unexpired personal access token. The token
+// only counts as an admin's when its owner is one and it has the admin scope.
+func (s *AuthService) validateAccessToken(ctx context.Context, token string) (*Claims, error) {
+	if !strings.HasPrefix(token, accessTokenPrefix) {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	now := time.Now().UTC()
+	claims := &Claims{}
+	var scopes string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.scopes, u.id, u.username, u.is_admin
+		FROM access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND (t.expires_at IS NULL OR t.expires_at > ?)
+	`, hashToken(token), now.Format(sqliteTimeFormat)).Scan(&claims.AccessTokenID, &scopes, &claims.UserID, &claims.Username, &claims.IsAdmin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims.Scopes = strings.Fields(scopes)
+	claims.IsAdmin = claims.IsAdmin && claims.HasScope(ScopeAdmin)
+
+	// last use is only tracked to the minute, so a busy script doesn't write on every request
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE access_tokens SET last_used_at = ?
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)
+	`, now.Format(sqliteTimeFormat), claims.AccessTokenID, now.Add(-time.Minute).Format(sqliteTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (s *AuthService) queryAccessTokens(ctx context.Context, where string, args ...any) ([]types.AccessToken, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at FROM access_tokens "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]types.AccessToken, 0)
+	for rows.Next() {
+		var token types.AccessToken
+		var scopes string
+		err := rows.Scan(&token.ID, &token.Name, &token.Prefix, &scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Fields(scopes)
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// randomToken returns 256 random bits, url safe.
+func randomToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashToken is what is stored in place of a random token or code. They are random, so a plain
+// sha256 is enough to keep them from being usable if the database leaks.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"context"
 	"database/sql"
-	"dsn/core/config"
 	"dsn/core/database"
+	"dsn/core/keyring"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -17,62 +20,110 @@ type Claims struct {
 	Username string `json:"username"`
 	IsAdmin  bool   `json:"is_admin"`
 	jwt.RegisteredClaims
+
+	// set when the request was made with a personal access token rather than a session
+	AccessTokenID int      `json:"-"`
+	Scopes        []string `json:"-"`
+}
+
+// HasScope reports whether the claims grant scope. A session grants every scope, a personal
+// access token only those it was created with.
+func (c *Claims) HasScope(scope string) bool {
+	if c.AccessTokenID == 0 {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
 }
 
 type AuthService struct {
-	jwtSecret []byte
-	db        *sql.DB
+	keys *keyring.Keyring
+	db   *sql.DB
 }
 
 func NewAuthService() *AuthService {
 	return &AuthService{
-		jwtSecret: []byte(config.JwtSecret),
-		db:        database.DB,
+		keys: keyring.Default,
+		db:   database.DB,
 	}
 }
 
-func (s *AuthService) GenerateToken(userID int, username string, isAdmin bool) (string, error) {
+// An access token is short-lived so it is never far behind the user's account. The session behind
+// it lasts as long as its refresh token keeps being used.
+const (
+	accessTokenDuration  = 15 * time.Minute
+	refreshTokenDuration = 30 * 24 * time.Hour
+)
+
+// refreshCookiePath limits the refresh cookie to the api, where refreshing and logging out happen.
+const refreshCookiePath = "/api"
+
+// GenerateToken returns an access token for the session, carrying the user's current name and
+// admin flag. Its jti is the session's ID, and it is signed with the active key named by its kid.
+func (s *AuthService) GenerateToken(sessionID string, userID int, username string, isAdmin bool) (string, error) {
+	now := time.Now()
 	claims := &Claims{
 		UserID:   userID,
 		Username: username,
 		IsAdmin:  isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+	kid, method, key, err := s.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
 }
 
-func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
+// ValidateToken checks a session token's signature and that its session has not been revoked.
+// The user's name and admin flag are taken from the database, so changes apply at once.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.jwtSecret, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		return s.keys.VerificationKey(kid, token.Method.Alg())
+	}, jwt.WithValidMethods(keyring.Algorithms))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	if err := s.checkSession(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
+// GetUserFromRequest authenticates a request by its personal access token, sent as
+// "Authorization: Bearer", or else by its auth_token cookie.
 func (s *AuthService) GetUserFromRequest(r *http.Request) (*Claims, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, fmt.Errorf("unsupported authorization scheme")
+		}
+		return s.validateAccessToken(r.Context(), token)
+	}
+
 	cookie, err := r.Cookie("auth_token")
 	if err != nil {
 		return nil, fmt.Errorf("no auth token found")
 	}
 
-	return s.ValidateToken(cookie.Value)
+	return s.ValidateToken(r.Context(), cookie.Value)
 }
 
 func (s *AuthService) SetAuthCookie(w http.ResponseWriter, token string) {
@@ -80,7 +131,7 @@ func (s *AuthService) SetAuthCookie(w http.ResponseWriter, token string) {
 		Name:     "auth_token",
 		Value:    token,
 		Path:     "/",
-		MaxAge:   24 * 60 * 60,
+		MaxAge:   int(accessTokenDuration.Seconds()),
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteStrictMode,
@@ -88,12 +139,12 @@ func (s *AuthService) SetAuthCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, cookie)
 }
 
-func (s *AuthService) ClearAuthCookie(w http.ResponseWriter) {
+func (s *AuthService) SetRefreshCookie(w http.ResponseWriter, token string) {
 	cookie := &http.Cookie{
-		Name:     "auth_token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
+		Name:     "refresh_token",
+		Value:    token,
+		Path:     refreshCookiePath,
+		MaxAge:   int(refreshTokenDuration.Seconds()),
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteStrictMode,
@@ -101,6 +152,17 @@ func (s *AuthService) ClearAuthCookie(w http.ResponseWriter) {
 	http.SetCookie(w, cookie)
 }
 
+// ClearAuthCookie clears both the access and the refresh cookie.
+func (s *AuthService) ClearAuthCookie(w http.ResponseWriter) {
+	for _, cookie := range []*http.Cookie{{Name: "auth_token", Path: "/"}, {Name: "refresh_token", Path: refreshCookiePath}} {
+		cookie.MaxAge = -1
+		cookie.HttpOnly = true
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteStrictMode
+		http.SetCookie(w, cookie)
+	}
+}
+
 func (s *AuthService) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims, err := s.GetUserFromRequest(r)
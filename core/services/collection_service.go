@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"dsn/core/database"
+	"dsn/core/types"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const collectionColumns = "id, name, query, filters, sort, direction, last_opened_at, created_at, updated_at"
+
+type CollectionService struct {
+	db *sql.DB
+}
+
+func NewCollectionService() *CollectionService {
+	return &CollectionService{db: database.DB}
+}
+
+// ValidateCollection checks the sort and filters of a saved search. A query that does not
+// parse returns a *QueryError.
+func ValidateCollection(req types.CollectionRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.Query != "" {
+		if _, err := parseSearchQuery(req.Query); err != nil {
+			return err
+		}
+	}
+	if req.Sort != "" && !IsValidNoteSort(req.Sort) {
+		return fmt.Errorf("unknown sort '%s'", req.Sort)
+	}
+	if req.Direction != "" && req.Direction != "asc" && req.Direction != "desc" {
+		return fmt.Errorf("dir must be asc or desc")
+	}
+
+	filters := req.Filters
+	if filters.Archived != "" && filters.Archived != "true" && filters.Archived != "only" {
+		return fmt.Errorf("archived must be true or only")
+	}
+	if filters.TagsMode != "" && filters.TagsMode != TagsModeAll && filters.TagsMode != TagsModeAny {
+		return fmt.Errorf("tags_mode must be all or any")
+	}
+	if filters.CreatedWithinDays < 0 || filters.UpdatedWithinDays < 0 {
+		return fmt.Errorf("within days can't be negative")
+	}
+
+	return nil
+}
+
+func (s *CollectionService) Create(ctx context.Context, userID int, req types.CollectionRequest) (*types.Collection, error) {
+	filters, err := json.Marshal(req.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO collections (user_id, name, query, filters, sort, direction)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, req.Name, req.Query, string(filters), req.Sort, req.Direction).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, id, userID)
+}
+
+// GetAll returns the user's collections by name, with unread counts when withUnread is set.
+func (s *CollectionService) GetAll(ctx context.Context, userID int, withUnread bool) ([]types.Collection, error) {
+	collections, err := s.query(ctx, "SELECT "+collectionColumns+" FROM collections WHERE user_id = ? ORDER BY name COLLATE NOCASE", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if withUnread {
+		for i := range collections {
+			unread, err := s.unreadCount(ctx, userID, collections[i])
+			if err != nil {
+				return nil, err
+			}
+			collections[i].Unread = &unread
+		}
+	}
+
+	return collections, nil
+}
+
+func (s *CollectionService) GetByID(ctx context.Context, id, userID int) (*types.Collection, error) {
+	collections, err := s.query(ctx, "SELECT "+collectionColumns+" FROM collections WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, fmt.Errorf("collection with id %d: %w", id, ErrNotFound)
+	}
+
+	return &collections[0], nil
+}
+
+func (s *CollectionService) Update(ctx context.Context, id, userID int, req types.CollectionRequest) (*types.Collection, error) {
+	filters, err := json.Marshal(req.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE collections
+		SET name = ?, query = ?, filters = ?, sort = ?, direction = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?
+	`, req.Name, req.Query, string(filters), req.Sort, req.Direction, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("collection with id %d: %w", id, ErrNotFound)
+	}
+
+	return s.GetByID(ctx, id, userID)
+}
+
+func (s *CollectionService) Delete(ctx context.Context, id, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM collections WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("collection with id %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// MarkOpened records that the collection was just read, which resets its unread count.
+func (s *CollectionService) MarkOpened(ctx context.Context, id, userID int) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE collections SET last_opened_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// CollectionListOptions turns a collection into the listing options for NoteService.List as of now.
+func CollectionListOptions(collection types.Collection, now time.Time) types.NoteListOptions {
+	filters := collection.Filters
+	opts := types.NoteListOptions{
+		IncludeArchived: filters.Archived == "true",
+		ArchivedOnly:    filters.Archived == "only",
+		Pinned:          filters.Pinned,
+		Color:           filters.Color,
+		TagIDs:          filters.Tags,
+		TagsMode:        filters.TagsMode,
+		ExcludeTagIDs:   filters.ExcludeTags,
+		Query:           collection.Query,
+		Sort:            collection.Sort,
+		Direction:       collection.Direction,
+	}
+
+	if filters.CreatedWithinDays > 0 {
+		after := now.AddDate(0, 0, -filters.CreatedWithinDays)
+		opts.CreatedAfter = &after
+	}
+	if filters.UpdatedWithinDays > 0 {
+		after := now.AddDate(0, 0, -filters.UpdatedWithinDays)
+		opts.UpdatedAfter = &after
+	}
+
+	return opts
+}
+
+func (s *CollectionService) unreadCount(ctx context.Context, userID int, collection types.Collection) (int, error) {
+	opts := CollectionListOptions(collection, time.Now())
+	if collection.LastOpenedAt != nil && (opts.UpdatedAfter == nil || collection.LastOpenedAt.After(*opts.UpdatedAfter)) {
+		opts.UpdatedAfter = collection.LastOpenedAt
+	}
+
+	where, args, err := noteListFilters(userID, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var unread int
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes WHERE "+strings.Join(where, " AND "), args...).Scan(&unread)
+	return unread, err
+}
+
+func (s *CollectionService) query(ctx context.Context, query string, args ...any) ([]types.Collection, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]types.Collection, 0)
+	for rows.Next() {
+		var collection types.Collection
+		var filters string
+		err := rows.Scan(&collection.ID, &collection.Name, &collection.Query, &filters, &collection.Sort,
+			&collection.Direction, &collection.LastOpenedAt, &collection.CreatedAt, &collection.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(filters), &collection.Filters); err != nil {
+			return nil, fmt.Errorf("filters of collection %d: %w", collection.ID, err)
+		}
+		collections = append(collections, collection)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"dsn/core/config"
+	"dsn/core/database"
+	"dsn/core/keyring"
+	"dsn/core/types"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncruces/go-sqlite3"
+	"github.com/tetratelabs/wazero"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "dsn-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// compiling SQLite takes longer than the tests themselves, the interpreter starts at once
+	sqlite3.RuntimeConfig = wazero.NewRuntimeConfigInterpreter()
+	log.SetOutput(io.Discard)
+	config.DatabaseDirectory = filepath.Join(dir, "database")
+	config.KeysDirectory = filepath.Join(dir, "keys")
+	config.JwtAlgorithm = keyring.AlgorithmHS256
+	if err := os.MkdirAll(config.DatabaseDirectory, 0755); err != nil {
+		log.Fatal(err)
+	}
+	database.Initialise(context.Background())
+	keyring.Initialise()
+
+	code := m.Run()
+
+	database.CleanShutdown()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// createTestUser adds a user to the test database.
+func createTestUser(t testing.TB, username string) *types.User {
+	t.Helper()
+
+	user, err := NewUserService().Create(types.CreateUserRequest{Username: username, Email: username + "@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"dsn/core/types"
+	"fmt"
+	"strings"
+)
+
+const (
+	BulkArchive   = "archive"
+	BulkUnarchive = "unarchive"
+	BulkPin       = "pin"
+	BulkUnpin     = "unpin"
+	BulkColor     = "color"
+	BulkDelete    = "delete"
+	BulkAddTag    = "add_tag"
+	BulkRemoveTag = "remove_tag"
+	BulkMove      = "move"
+)
+
+const (
+	BulkStatusUpdated   = "updated"
+	BulkStatusUnchanged = "unchanged"
+	BulkStatusNotFound  = "not_found"
+)
+
+const MaxBulkNotes = 500
+
+// bulkStatements are the writes of the operations on one note, which affect no row when the
+// note is already as asked. Writes to the note itself bump its version as single note writes do.
+var bulkStatements = map[string]string{
+	BulkArchive:   "UPDATE notes SET archived = TRUE, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND archived = FALSE",
+	BulkUnarchive: "UPDATE notes SET archived = FALSE, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND archived = TRUE",
+	BulkPin:       "UPDATE notes SET pinned = TRUE, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND pinned = FALSE",
+	BulkUnpin:     "UPDATE notes SET pinned = FALSE, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND pinned = TRUE",
+	BulkColor:     "UPDATE notes SET color = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND color != ?",
+	BulkDelete:    "UPDATE notes SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?",
+	BulkAddTag:    "INSERT OR IGNORE INTO note_tags (note_id, tag_id) VALUES (?, ?)",
+	BulkRemoveTag: "DELETE FROM note_tags WHERE note_id = ? AND tag_id = ?",
+	BulkMove:      "UPDATE notes SET order_position = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND order_position != ?",
+}
+
+// ValidateBulkNoteRequest checks that a bulk request names a known operation, the notes and
+// whatever else the operation needs.
+func ValidateBulkNoteRequest(req types.BulkNoteRequest) error {
+	if _, ok := bulkStatements[req.Operation]; !ok {
+		return fmt.Errorf("unknown operation '%s'", req.Operation)
+	}
+	if len(req.NoteIDs) == 0 || len(req.NoteIDs) > MaxBulkNotes {
+		return fmt.Errorf("note_ids must have between 1 and %d notes", MaxBulkNotes)
+	}
+
+	switch req.Operation {
+	case BulkColor:
+		if req.Color == "" {
+			return fmt.Errorf("color is required")
+		}
+	case BulkAddTag, BulkRemoveTag:
+		if req.TagID < 1 {
+			return fmt.Errorf("tag_id is required")
+		}
+	case BulkMove:
+		if req.Position == nil {
+			return fmt.Errorf("position is required")
+		}
+	}
+
+	return nil
+}
+
+// Bulk applies one operation to the user's notes in a single transaction and reports per note
+// whether it changed, was already as asked or is not one of the user's notes outside the trash.
+// Moved notes take consecutive positions from Position in the order given. A tag the user does
+// not own fails the whole request with ErrNotFound.
+func (s *NoteService) Bulk(ctx context.Context, userID int, req types.BulkNoteRequest) ([]types.BulkNoteResult, error) {
+	noteIDs := uniqueIDs(req.NoteIDs)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if req.Operation == BulkAddTag || req.Operation == BulkRemoveTag {
+		if err := checkTagsOwned(tx, userID, []int{req.TagID}); err != nil {
+			return nil, err
+		}
+	}
+
+	query := "SELECT id FROM notes WHERE user_id = ? AND deleted_at IS NULL AND id IN (?" + strings.Repeat(", ?", len(noteIDs)-1) + ")"
+	rows, err := tx.QueryContext(ctx, query, appendIDs([]any{userID}, noteIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[int]bool, len(noteIDs))
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		owned[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statement := bulkStatements[req.Operation]
+	results := make([]types.BulkNoteResult, 0, len(noteIDs))
+	position := 0
+	for _, id := range noteIDs {
+		if !owned[id] {
+			results = append(results, types.BulkNoteResult{ID: id, Status: BulkStatusNotFound})
+			continue
+		}
+
+		var args []any
+		switch req.Operation {
+		case BulkColor:
+			args = []any{req.Color, id, req.Color}
+		case BulkAddTag, BulkRemoveTag:
+			args = []any{id, req.TagID}
+		case BulkMove:
+			args = []any{*req.Position + position, id, *req.Position + position}
+			position++
+		default:
+			args = []any{id}
+		}
+
+		result, err := tx.ExecContext(ctx, statement, args...)
+		if err != nil {
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		status := BulkStatusUpdated
+		if rowsAffected == 0 {
+			status = BulkStatusUnchanged
+		}
+		results = append(results, types.BulkNoteResult{ID: id, Status: status})
+	}
+
+	return results, tx.Commit()
+}
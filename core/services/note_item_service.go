@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"dsn/core/database"
+	"dsn/core/types"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotChecklist is returned when items are written to a note that is not a checklist.
+var ErrNotChecklist = errors.New("note is not a checklist")
+
+type NoteItemService struct {
+	db *sql.DB
+}
+
+func NewNoteItemService() *NoteItemService {
+	return &NoteItemService{db: database.DB}
+}
+
+func IsValidNoteKind(kind string) bool {
+	return kind == types.NoteKindText || kind == types.NoteKindChecklist
+}
+
+// Create adds an item to a checklist, at the end unless req sets a position.
+func (s *NoteItemService) Create(ctx context.Context, noteID, userID int, req types.CreateNoteItemRequest) (*types.NoteItem, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkChecklist(ctx, tx, noteID, userID); err != nil {
+		return nil, err
+	}
+
+	var position int
+	if req.Position != nil {
+		position = max(*req.Position, 0)
+		_, err := tx.ExecContext(ctx, "UPDATE note_items SET position = position + 1 WHERE note_id = ? AND position >= ?", noteID, position)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(position) + 1, 0) FROM note_items WHERE note_id = ?", noteID).Scan(&position)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	item := types.NoteItem{NoteID: noteID, Text: req.Text, Checked: req.Checked, Position: position}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO note_items (note_id, text, checked, position)
+		VALUES (?, ?, ?, ?)
+		RETURNING id, created_at, updated_at
+	`, noteID, req.Text, req.Checked, position).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := touchNote(ctx, tx, noteID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// Update changes the text or checked state of an item.
+func (s *NoteItemService) Update(ctx context.Context, noteID, itemID, userID int, req types.UpdateNoteItemRequest) (*types.NoteItem, error) {
+	var setParts []string
+	var args []interface{}
+
+	if req.Text != nil {
+		setParts = append(setParts, "text = ?")
+		args = append(args, *req.Text)
+	}
+	if req.Checked != nil {
+		setParts = append(setParts, "checked = ?")
+		args = append(args, *req.Checked)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkChecklist(ctx, tx, noteID, userID); err != nil {
+		return nil, err
+	}
+
+	if len(setParts) > 0 {
+		setParts = append(setParts, "updated_at = CURRENT_TIMESTAMP")
+		args = append(args, itemID, noteID)
+
+		query := fmt.Sprintf("UPDATE note_items SET %s WHERE id = ? AND note_id = ?", strings.Join(setParts, ", "))
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, err
+		}
+
+		if err := touchNote(ctx, tx, noteID); err != nil {
+			return nil, err
+		}
+	}
+
+	var item types.NoteItem
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, note_id, text, checked, position, created_at, updated_at
+		FROM note_items
+		WHERE id = ? AND note_id = ?
+	`, itemID, noteID).Scan(&item.ID, &item.NoteID, &item.Text, &item.Checked, &item.Position, &item.CreatedAt, &item.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("item with id %d: %w", itemID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// UpdateOrder sets the positions of a checklist's items, keyed by item id.
+func (s *NoteItemService) UpdateOrder(ctx context.Context, noteID, userID int, itemOrders map[int]int) ([]types.NoteItem, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkChecklist(ctx, tx, noteID, userID); err != nil {
+		return nil, err
+	}
+
+	for itemID, position := range itemOrders {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE note_items
+			SET position = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND note_id = ?
+		`, position, itemID, noteID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := touchNote(ctx, tx, noteID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return getNoteItems(ctx, s.db, noteID)
+}
+
+func (s *NoteItemService) Delete(ctx context.Context, noteID, itemID, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkChecklist(ctx, tx, noteID, userID); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM note_items WHERE id = ? AND note_id = ?", itemID, noteID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("item with id %d: %w", itemID, ErrNotFound)
+	}
+
+	if err := touchNote(ctx, tx, noteID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkChecklist reports whether a user may change the items of a note.
+func checkChecklist(ctx context.Context, tx *sql.Tx, noteID, userID int) error {
+	var kind string
+	err := tx.QueryRowContext(ctx, "SELECT kind FROM notes WHERE id = ? AND user_id = ? AND deleted_at IS NULL", noteID, userID).Scan(&kind)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("note with id %d: %w", noteID, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	if kind != types.NoteKindChecklist {
+		return ErrNotChecklist
+	}
+
+	return nil
+}
+
+// touchNote marks a note as updated when its items change. The version is left alone,
+// ticking an item should not conflict with an edit of the note's text on another device.
+func touchNote(ctx context.Context, tx *sql.Tx, noteID int) error {
+	_, err := tx.ExecContext(ctx, "UPDATE notes SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", noteID)
+	return err
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func getNoteItems(ctx context.Context, db queryer, noteID int) ([]types.NoteItem, error) {
+	query := `
+		SELECT id, note_id, text, checked, position, created_at, updated_at
+		FROM note_items
+		WHERE note_id = ?
+		ORDER BY position, id
+	`
+
+	rows, err := db.QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]types.NoteItem, 0)
+	for rows.Next() {
+		var item types.NoteItem
+		err := rows.Scan(&item.ID, &item.NoteID, &item.Text, &item.Checked, &item.Position, &item.CreatedAt, &item.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func checklistProgress(items []types.NoteItem) *types.Progress {
+	progress := &types.Progress{Total: len(items)}
+	for _, item := range items {
+		if item.Checked {
+			progress.Done++
+		}
+	}
+	return progress
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"dsn/core/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqliteTimeFormat matches the text CURRENT_TIMESTAMP stores, so time values compare correctly as strings.
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+const (
+	TagsModeAll = "all"
+	TagsModeAny = "any"
+)
+
+const (
+	NoteSortManual  = "manual"
+	NoteSortUpdated = "updated"
+	NoteSortCreated = "created"
+	NoteSortTitle   = "title"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortColumn is a column notes are ordered by. Its value in a cursor is an integer when numeric
+// is set and a string otherwise; none of the columns is nullable.
+type sortColumn struct {
+	expression string
+	descending bool
+	numeric    bool
+	value      func(note *types.Note) any
+}
+
+var (
+	sortByPinned   = sortColumn{"pinned", true, true, func(n *types.Note) any { return boolToInt(n.Pinned) }}
+	sortByOrder    = sortColumn{"order_position", false, true, func(n *types.Note) any { return n.Order }}
+	sortByUpdated  = sortColumn{"updated_at", true, false, func(n *types.Note) any { return n.UpdatedAt.UTC().Format(sqliteTimeFormat) }}
+	sortByCreated  = sortColumn{"created_at", true, false, func(n *types.Note) any { return n.CreatedAt.UTC().Format(sqliteTimeFormat) }}
+	sortByTitle    = sortColumn{"title COLLATE NOCASE", false, false, func(n *types.Note) any { return n.Title }}
+	sortByIDDesc   = sortColumn{"id", true, true, func(n *types.Note) any { return n.ID }}
+	sortByIDAsc    = sortColumn{"id", false, true, func(n *types.Note) any { return n.ID }}
+	noteSortOrders = map[string][]sortColumn{
+		NoteSortManual:  {sortByPinned, sortByOrder, sortByUpdated, sortByIDDesc},
+		NoteSortUpdated: {sortByUpdated, sortByIDDesc},
+		NoteSortCreated: {sortByCreated, sortByIDDesc},
+		NoteSortTitle:   {sortByTitle, sortByIDAsc},
+	}
+)
+
+// noteCursor is the position after the last note of a page, tied to the sort it was issued for.
+type noteCursor struct {
+	Sort    string `json:"s"`
+	Reverse bool   `json:"r,omitempty"`
+	Values  []any  `json:"v"`
+}
+
+func IsValidNoteSort(sort string) bool {
+	_, ok := noteSortOrders[sort]
+	return ok
+}
+
+// List returns one page of a user's notes. Without a limit every matching note is returned.
+func (s *NoteService) List(ctx context.Context, userID int, opts types.NoteListOptions) (*types.NotePage, error) {
+	sort := opts.Sort
+	if sort == "" {
+		sort = NoteSortManual
+	}
+	columns, ok := noteSortOrders[sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", sort)
+	}
+	// a direction flips the whole sort when it disagrees with the primary key's natural order
+	reverse := opts.Direction != "" && (opts.Direction == "desc") != columns[0].descending
+	if reverse {
+		columns = reverseSort(columns)
+	}
+
+	where, args, err := noteListFilters(userID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM notes WHERE " + strings.Join(where, " AND ")
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := decodeNoteCursor(opts.Cursor)
+		if err != nil || cursor.Sort != sort || cursor.Reverse != reverse {
+			return nil, ErrInvalidCursor
+		}
+		values, err := cursorValues(columns, cursor.Values)
+		if err != nil {
+			return nil, err
+		}
+		condition, cursorArgs := keysetCondition(columns, values)
+		where = append(where, condition)
+		args = append(args, cursorArgs...)
+	}
+
+	orderBy := make([]string, len(columns))
+	for i, column := range columns {
+		orderBy[i] = column.expression + sortDirection(column.descending)
+	}
+
+	query := `
+		SELECT ` + noteColumns + `
+		FROM notes
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + strings.Join(orderBy, ", ")
+
+	if opts.Limit > 0 {
+		// one extra row tells whether there is a next page
+		query += " LIMIT ?"
+		args = append(args, opts.Limit+1)
+	}
+
+	notes, err := s.queryNotes(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &types.NotePage{Notes: notes, Total: total}
+	if opts.Limit > 0 && len(notes) > opts.Limit {
+		page.Notes = notes[:opts.Limit]
+		last := &page.Notes[len(page.Notes)-1]
+
+		values := make([]any, len(columns))
+		for i, column := range columns {
+			values[i] = column.value(last)
+		}
+		page.NextCursor, err = encodeNoteCursor(noteCursor{Sort: sort, Reverse: reverse, Values: values})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// noteListFilters builds the conditions of a listing. A malformed Query returns a *QueryError.
+func noteListFilters(userID int, opts types.NoteListOptions) ([]string, []any, error) {
+	where := []string{"user_id = ?"}
+	args := []any{userID}
+
+	switch {
+	case opts.ArchivedOnly:
+		where = append(where, "archived = TRUE")
+	case !opts.IncludeArchived:
+		where = append(where, "archived = FALSE")
+	}
+	if !opts.IncludeTrashed {
+		where = append(where, "deleted_at IS NULL")
+	}
+	if opts.Pinned != nil {
+		where = append(where, "pinned = ?")
+		args = append(args, *opts.Pinned)
+	}
+	if opts.Color != "" {
+		where = append(where, "color = ? COLLATE NOCASE")
+		args = append(args, opts.Color)
+	}
+
+	// notes tagged with any descendant of a tag count as tagged with it
+	if len(opts.TagIDs) > 0 {
+		if opts.TagsMode == TagsModeAny {
+			where = append(where, "EXISTS ("+taggedNoteQuery(len(opts.TagIDs))+")")
+			args = appendIDs(args, opts.TagIDs)
+		} else {
+			for _, tagID := range opts.TagIDs {
+				where = append(where, "EXISTS ("+taggedNoteQuery(1)+")")
+				args = append(args, tagID)
+			}
+		}
+	}
+	if len(opts.ExcludeTagIDs) > 0 {
+		where = append(where, "NOT EXISTS ("+taggedNoteQuery(len(opts.ExcludeTagIDs))+")")
+		args = appendIDs(args, opts.ExcludeTagIDs)
+	}
+	if opts.Query != "" {
+		condition, err := parseSearchQuery(opts.Query)
+		if err != nil {
+			return nil, nil, err
+		}
+		where = append(where, condition.sql)
+		args = append(args, condition.args...)
+	}
+
+	timeFilters := []struct {
+		condition string
+		value     *time.Time
+	}{
+		{"created_at >= ?", opts.CreatedAfter},
+		{"created_at < ?", opts.CreatedBefore},
+		{"updated_at >= ?", opts.UpdatedAfter},
+		{"updated_at < ?", opts.UpdatedBefore},
+	}
+	for _, filter := range timeFilters {
+		if filter.value != nil {
+			where = append(where, filter.condition)
+			args = append(args, filter.value.UTC().Format(sqliteTimeFormat))
+		}
+	}
+
+	return where, args, nil
+}
+
+// taggedNoteQuery selects the note_tags rows joining notes to any of count tag ids or their descendants.
+func taggedNoteQuery(count int) string {
+	roots := "SELECT id FROM tags WHERE id IN (?" + strings.Repeat(", ?", count-1) + ")"
+	return `
+		SELECT 1 FROM note_tags nt
+		WHERE nt.note_id = notes.id AND nt.tag_id IN (` + tagSubtreeQuery(roots) + `)`
+}
+
+func appendIDs(args []any, ids []int) []any {
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
+
+// keysetCondition selects the rows that sort after values, e.g. for (a DESC, b ASC):
+// a < ? OR (a = ? AND b > ?)
+func keysetCondition(columns []sortColumn, values []any) (string, []any) {
+	var alternatives []string
+	var args []any
+
+	for i, column := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j].expression+" = ?")
+			args = append(args, values[j])
+		}
+
+		operator := " > ?"
+		if column.descending {
+			operator = " < ?"
+		}
+		parts = append(parts, column.expression+operator)
+		args = append(args, values[i])
+
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+func reverseSort(columns []sortColumn) []sortColumn {
+	reversed := make([]sortColumn, len(columns))
+	for i, column := range columns {
+		column.descending = !column.descending
+		reversed[i] = column
+	}
+	return reversed
+}
+
+func sortDirection(descending bool) string {
+	if descending {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+func encodeNoteCursor(cursor noteCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeNoteCursor(encoded string) (*noteCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var cursor noteCursor
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+// cursorValues checks a decoded cursor holds one value of the right type for each sort column,
+// so a crafted cursor is refused with ErrInvalidCursor rather than reaching the query. Numbers
+// are kept as integers so they compare exactly against integer columns.
+func cursorValues(columns []sortColumn, values []any) ([]any, error) {
+	if len(values) != len(columns) {
+		return nil, ErrInvalidCursor
+	}
+
+	checked := make([]any, len(values))
+	for i, column := range columns {
+		switch value := values[i].(type) {
+		case json.Number:
+			number, err := value.Int64()
+			if err != nil || !column.numeric {
+				return nil, ErrInvalidCursor
+			}
+			checked[i] = number
+		case string:
+			if column.numeric {
+				return nil, ErrInvalidCursor
+			}
+			checked[i] = value
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return checked, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
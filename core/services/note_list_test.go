@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"dsn/core/types"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestListPagesWithCursor(t *testing.T) {
+	ctx := context.Background()
+	notes := NewNoteService()
+	user := createTestUser(t, "list-cursor")
+
+	for i := range 5 {
+		if _, err := notes.Create(ctx, user.ID, types.CreateNoteRequest{Title: fmt.Sprintf("note %d", i), Pinned: i%2 == 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sort := range []string{NoteSortManual, NoteSortUpdated, NoteSortCreated, NoteSortTitle} {
+		t.Run(sort, func(t *testing.T) {
+			seen := make(map[int]bool)
+			opts := types.NoteListOptions{Sort: sort, Limit: 2}
+			for {
+				page, err := notes.List(ctx, user.ID, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, note := range page.Notes {
+					if seen[note.ID] {
+						t.Fatalf("note %d listed twice", note.ID)
+					}
+					seen[note.ID] = true
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				opts.Cursor = page.NextCursor
+			}
+			if len(seen) != 5 {
+				t.Errorf("paged through %d notes, want 5", len(seen))
+			}
+		})
+	}
+}
+
+func TestListRejectsMalformedCursor(t *testing.T) {
+	ctx := context.Background()
+	notes := NewNoteService()
+	user := createTestUser(t, "list-bad-cursor")
+
+	if _, err := notes.Create(ctx, user.ID, types.CreateNoteRequest{Title: "note"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the manual sort takes pinned, order_position, updated_at and id
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"not json", `{"s":"manual"`},
+		{"other sort", `{"s":"title","v":["a",1]}`},
+		{"too few values", `{"s":"manual","v":[1,0,"2026-01-01 00:00:00"]}`},
+		{"too many values", `{"s":"manual","v":[1,0,"2026-01-01 00:00:00",1,1]}`},
+		{"array", `{"s":"manual","v":[[1],0,"2026-01-01 00:00:00",1]}`},
+		{"object", `{"s":"manual","v":[1,{"a":1},"2026-01-01 00:00:00",1]}`},
+		{"boolean", `{"s":"manual","v":[true,0,"2026-01-01 00:00:00",1]}`},
+		{"null", `{"s":"manual","v":[1,0,null,1]}`},
+		{"fraction", `{"s":"manual","v":[1,0.5,"2026-01-01 00:00:00",1]}`},
+		{"string for a number", `{"s":"manual","v":[1,"0","2026-01-01 00:00:00",1]}`},
+		{"number for a string", `{"s":"manual","v":[1,0,20260101,1]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := tt.cursor
+			if cursor != "!!!" {
+				cursor = base64.RawURLEncoding.EncodeToString([]byte(cursor))
+			}
+			_, err := notes.List(ctx, user.ID, types.NoteListOptions{Cursor: cursor, Limit: 1})
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"dsn/core/types"
+	"fmt"
+	"time"
+)
+
+// SetReminder schedules a reminder for a note at remindAt, repeating by recurrence
+// when it is not empty. The recurrence must be valid for logic.ParseRecurrence, and
+// its days are counted in the IANA timeZone, or UTC when that is empty.
+func (s *NoteService) SetReminder(ctx context.Context, id, userID int, remindAt time.Time, recurrence, timeZone string) (*types.Note, error) {
+	query := `
+		UPDATE notes
+		SET remind_at = ?, recurrence = ?, time_zone = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`
+
+	result, err := s.db.ExecContext(ctx, query, remindAt.UTC().Format(sqliteTimeFormat), recurrence, timeZone, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("note with id %d: %w", id, ErrNotFound)
+	}
+
+	return s.GetByID(ctx, id, userID, false)
+}
+
+// ClearReminder removes a note's reminder along with any fired one not yet dismissed.
+func (s *NoteService) ClearReminder(ctx context.Context, id, userID int) (*types.Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE notes
+		SET remind_at = NULL, recurrence = '', time_zone = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("note with id %d: %w", id, ErrNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM due_reminders WHERE note_id = ?", id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, id, userID, false)
+}
+
+// UpcomingReminders returns the notes with a reminder due before until, soonest first.
+func (s *NoteService) UpcomingReminders(ctx context.Context, userID int, until time.Time) ([]types.Note, error) {
+	query := `
+		SELECT ` + noteColumns + `
+		FROM notes
+		WHERE user_id = ? AND deleted_at IS NULL AND remind_at IS NOT NULL AND remind_at <= ?
+		ORDER BY remind_at, id
+	`
+
+	return s.queryNotes(ctx, query, userID, until.UTC().Format(sqliteTimeFormat))
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"dsn/core/database"
+	"dsn/core/logic"
+	"dsn/core/types"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const noteRuleColumns = `id, name, enabled, match_field, match_type, pattern, match_tag_id, match_color,
+	add_tag_id, set_color, pin, archive, created_at`
+
+type NoteRuleService struct {
+	db *sql.DB
+}
+
+func NewNoteRuleService() *NoteRuleService {
+	return &NoteRuleService{db: database.DB}
+}
+
+// ValidateNoteRule fills in the default field and match type of a rule and checks that it has
+// a condition, an action and, for regex rules, a pattern that compiles.
+func ValidateNoteRule(req *types.NoteRuleRequest) error {
+	if req.Match.Field == "" {
+		req.Match.Field = types.RuleFieldAny
+	}
+	if req.Match.Type == "" {
+		req.Match.Type = types.RuleMatchSubstring
+	}
+
+	switch req.Match.Field {
+	case types.RuleFieldAny, types.RuleFieldTitle, types.RuleFieldContent:
+	default:
+		return fmt.Errorf("unknown field %q", req.Match.Field)
+	}
+
+	switch req.Match.Type {
+	case types.RuleMatchSubstring:
+	case types.RuleMatchRegex:
+		if _, err := regexp.Compile(req.Match.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown match type %q", req.Match.Type)
+	}
+
+	if req.Match.Pattern == "" && req.Match.TagID == nil && req.Match.Color == "" {
+		return fmt.Errorf("a pattern, tag or color to match is required")
+	}
+
+	actions := req.Actions
+	if actions.AddTagID == nil && actions.SetColor == "" && !actions.Pin && !actions.Archive {
+		return fmt.Errorf("at least one action is required")
+	}
+
+	return nil
+}
+
+// Create saves a rule checked by ValidateNoteRule. The tags it names must belong to the user.
+func (s *NoteRuleService) Create(ctx context.Context, userID int, req types.NoteRuleRequest) (*types.NoteRule, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkTagsOwned(tx, userID, ruleTagIDs(req)); err != nil {
+		return nil, err
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO note_rules (user_id, name, enabled, match_field, match_type, pattern, match_tag_id, match_color,
+			add_tag_id, set_color, pin, archive)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, req.Name, enabled, req.Match.Field, req.Match.Type, req.Match.Pattern, req.Match.TagID, req.Match.Color,
+		req.Actions.AddTagID, req.Actions.SetColor, req.Actions.Pin, req.Actions.Archive).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, id, userID)
+}
+
+func (s *NoteRuleService) GetAll(ctx context.Context, userID int) ([]types.NoteRule, error) {
+	return queryNoteRules(ctx, s.db, "SELECT "+noteRuleColumns+" FROM note_rules WHERE user_id = ? ORDER BY id", userID)
+}
+
+func (s *NoteRuleService) GetByID(ctx context.Context, id, userID int) (*types.NoteRule, error) {
+	rules, err := queryNoteRules(ctx, s.db, "SELECT "+noteRuleColumns+" FROM note_rules WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("rule with id %d: %w", id, ErrNotFound)
+	}
+
+	return &rules[0], nil
+}
+
+// Update replaces a rule with req, which must have been checked by ValidateNoteRule.
+func (s *NoteRuleService) Update(ctx context.Context, id, userID int, req types.NoteRuleRequest) (*types.NoteRule, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkTagsOwned(tx, userID, ruleTagIDs(req)); err != nil {
+		return nil, err
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE note_rules
+		SET name = ?, enabled = ?, match_field = ?, match_type = ?, pattern = ?, match_tag_id = ?, match_color = ?,
+			add_tag_id = ?, set_color = ?, pin = ?, archive = ?
+		WHERE id = ? AND user_id = ?
+	`, req.Name, enabled, req.Match.Field, req.Match.Type, req.Match.Pattern, req.Match.TagID, req.Match.Color,
+		req.Actions.AddTagID, req.Actions.SetColor, req.Actions.Pin, req.Actions.Archive, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("rule with id %d: %w", id, ErrNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, id, userID)
+}
+
+func (s *NoteRuleService) Delete(ctx context.Context, id, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM note_rules WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("rule with id %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// Apply runs a rule over the user's notes outside the trash, whether or not it is enabled, and
+// returns the ids of the notes it changes. With dryRun nothing is written.
+func (s *NoteRuleService) Apply(ctx context.Context, id, userID int, dryRun bool) ([]int, error) {
+	rule, err := s.GetByID(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	notes, err := loadRuleNotes(ctx, tx, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := rulePattern(*rule)
+	affected := make([]int, 0)
+	for _, before := range notes {
+		after := before.clone()
+		if !ruleMatches(*rule, pattern, after) || !applyRuleActions(*rule, after, ruleOverrides{}) {
+			continue
+		}
+		affected = append(affected, before.id)
+
+		if !dryRun {
+			// unlike a write through NoteService, a retroactive change is new to clients holding the note
+			if err := saveRuleNote(ctx, tx, before, after, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if dryRun {
+		return affected, nil
+	}
+
+	return affected, tx.Commit()
+}
+
+func ruleTagIDs(req types.NoteRuleRequest) []int {
+	var ids []int
+	for _, id := range []*int{req.Match.TagID, req.Actions.AddTagID} {
+		if id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	return ids
+}
+
+func queryNoteRules(ctx context.Context, db queryer, query string, args ...any) ([]types.NoteRule, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]types.NoteRule, 0)
+	for rows.Next() {
+		var rule types.NoteRule
+		err := rows.Scan(&rule.ID, &rule.Name, &rule.Enabled, &rule.Match.Field, &rule.Match.Type, &rule.Match.Pattern,
+			&rule.Match.TagID, &rule.Match.Color, &rule.Actions.AddTagID, &rule.Actions.SetColor, &rule.Actions.Pin,
+			&rule.Actions.Archive, &rule.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// ruleNote is the part of a note that rules match on and change. Its text is the plain text of
+// the content followed by the checklist items, as in the search index.
+type ruleNote struct {
+	id       int
+	title    string
+	text     string
+	color    string
+	pinned   bool
+	archived bool
+	tagIDs   []int
+}
+
+func (n *ruleNote) clone() *ruleNote {
+	copied := *n
+	copied.tagIDs = slices.Clone(n.tagIDs)
+	return &copied
+}
+
+// ruleOverrides are the fields a write sets itself, which rules leave alone so that, say,
+// unarchiving a note is not undone by a rule that archives it.
+type ruleOverrides struct {
+	color    bool
+	pinned   bool
+	archived bool
+}
+
+// runNoteRules applies the user's enabled rules in order to a note just written in tx and
+// reports whether they changed it. A rule sees the changes of the rules before it.
+func runNoteRules(ctx context.Context, tx *sql.Tx, userID, noteID int, overrides ruleOverrides) (bool, error) {
+	rules, err := queryNoteRules(ctx, tx,
+		"SELECT "+noteRuleColumns+" FROM note_rules WHERE user_id = ? AND enabled ORDER BY id", userID)
+	if err != nil || len(rules) == 0 {
+		return false, err
+	}
+
+	notes, err := loadRuleNotes(ctx, tx, userID, noteID)
+	if err != nil || len(notes) == 0 {
+		return false, err
+	}
+
+	before := notes[0]
+	after := before.clone()
+	changed := false
+	for _, rule := range rules {
+		if ruleMatches(rule, rulePattern(rule), after) && applyRuleActions(rule, after, overrides) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	return true, saveRuleNote(ctx, tx, before, after, false)
+}
+
+// loadRuleNotes loads the user's notes outside the trash, or only noteID when it is not 0.
+func loadRuleNotes(ctx context.Context, tx *sql.Tx, userID, noteID int) ([]*ruleNote, error) {
+	where := "n.user_id = ? AND n.deleted_at IS NULL"
+	args := []any{userID}
+	if noteID != 0 {
+		where += " AND n.id = ?"
+		args = append(args, noteID)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT n.id, n.title, n.content, n.color, n.pinned, n.archived FROM notes n WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []*ruleNote
+	byID := make(map[int]*ruleNote)
+	for rows.Next() {
+		var note ruleNote
+		var content string
+		if err := rows.Scan(&note.id, &note.title, &content, &note.color, &note.pinned, &note.archived); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		note.text = logic.HTMLToText(content)
+		notes = append(notes, &note)
+		byID[note.id] = &note
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT i.note_id, i.text
+		FROM note_items i
+		JOIN notes n ON n.id = i.note_id
+		WHERE `+where+`
+		ORDER BY i.note_id, i.position, i.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if note := byID[id]; note != nil {
+			note.text += "\n" + text
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT nt.note_id, nt.tag_id
+		FROM note_tags nt
+		JOIN notes n ON n.id = nt.note_id
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, tagID int
+		if err := rows.Scan(&id, &tagID); err != nil {
+			return nil, err
+		}
+		if note := byID[id]; note != nil {
+			note.tagIDs = append(note.tagIDs, tagID)
+		}
+	}
+
+	return notes, rows.Err()
+}
+
+// rulePattern compiles the pattern of a regex rule, so a run over many notes compiles it once.
+// It returns nil for other rules, and for a pattern that doesn't compile, which matches nothing.
+func rulePattern(rule types.NoteRule) *regexp.Regexp {
+	if rule.Match.Type != types.RuleMatchRegex {
+		return nil
+	}
+	pattern, err := regexp.Compile(rule.Match.Pattern)
+	if err != nil {
+		return nil
+	}
+	return pattern
+}
+
+// ruleMatches reports whether note meets the rule's conditions. pattern is the rule's compiled
+// regex, see rulePattern.
+func ruleMatches(rule types.NoteRule, pattern *regexp.Regexp, note *ruleNote) bool {
+	match := rule.Match
+	if match.TagID != nil && !slices.Contains(note.tagIDs, *match.TagID) {
+		return false
+	}
+	if match.Color != "" && !strings.EqualFold(match.Color, note.color) {
+		return false
+	}
+	if match.Pattern == "" {
+		return true
+	}
+
+	var fields []string
+	switch match.Field {
+	case types.RuleFieldTitle:
+		fields = []string{note.title}
+	case types.RuleFieldContent:
+		fields = []string{note.text}
+	default:
+		fields = []string{note.title, note.text}
+	}
+
+	if match.Type == types.RuleMatchRegex {
+		return pattern != nil && slices.ContainsFunc(fields, pattern.MatchString)
+	}
+
+	substring := strings.ToLower(match.Pattern)
+	return slices.ContainsFunc(fields, func(field string) bool {
+		return strings.Contains(strings.ToLower(field), substring)
+	})
+}
+
+// applyRuleActions applies a rule's actions to note and reports whether anything changed.
+func applyRuleActions(rule types.NoteRule, note *ruleNote, overrides ruleOverrides) bool {
+	actions := rule.Actions
+	changed := false
+
+	if actions.AddTagID != nil && !slices.Contains(note.tagIDs, *actions.AddTagID) {
+		note.tagIDs = append(note.tagIDs, *actions.AddTagID)
+		changed = true
+	}
+	if actions.SetColor != "" && !overrides.color && note.color != actions.SetColor {
+		note.color = actions.SetColor
+		changed = true
+	}
+	if actions.Pin && !overrides.pinned && !note.pinned {
+		note.pinned = true
+		changed = true
+	}
+	if actions.Archive && !overrides.archived && !note.archived {
+		note.archived = true
+		changed = true
+	}
+
+	return changed
+}
+
+func saveRuleNote(ctx context.Context, tx *sql.Tx, before, after *ruleNote, bumpVersion bool) error {
+	if after.color != before.color || after.pinned != before.pinned || after.archived != before.archived {
+		query := "UPDATE notes SET color = ?, pinned = ?, archived = ? WHERE id = ?"
+		if bumpVersion {
+			query = "UPDATE notes SET color = ?, pinned = ?, archived = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+		}
+		if _, err := tx.ExecContext(ctx, query, after.color, after.pinned, after.archived, after.id); err != nil {
+			return err
+		}
+	}
+
+	for _, tagID := range after.tagIDs {
+		if slices.Contains(before.tagIDs, tagID) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO note_tags (note_id, tag_id) VALUES (?, ?)", after.id, tagID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"dsn/core/types"
+	"html"
+	"strings"
+)
+
+// snippets are marked with control characters by sqlite and turned into <mark> once escaped
+const (
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+)
+
+var highlightReplacer = strings.NewReplacer(highlightStart, "<mark>", highlightEnd, "</mark>")
+
+// Search finds notes matching a query in the search grammar of parseSearchQuery.
+// Notes matching the full-text terms best come first, a malformed query returns a *QueryError.
+func (s *NoteService) Search(ctx context.Context, userID int, query string, includeTrashed bool) ([]types.NoteSearchResult, error) {
+	condition, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []any
+	highlights := "'', notes.title"
+	join := ""
+	orderBy := "notes.pinned DESC, notes.updated_at DESC, notes.id"
+
+	// notes matching the text terms are ranked and highlighted, filter-only queries keep the usual order
+	if len(condition.matchTerms) > 0 {
+		highlights = "COALESCE(m.snippet, ''), COALESCE(m.title_highlight, notes.title)"
+		join = `
+		LEFT JOIN (
+			SELECT rowid,
+				snippet(notes_fts, -1, char(2), char(3), '…', 24) AS snippet,
+				highlight(notes_fts, 0, char(2), char(3)) AS title_highlight,
+				bm25(notes_fts, 10.0, 1.0) AS rank
+			FROM notes_fts
+			WHERE notes_fts MATCH ?
+		) AS m ON m.rowid = notes.id`
+		orderBy = "m.rank IS NULL, m.rank, " + orderBy
+		args = append(args, strings.Join(condition.matchTerms, " OR "))
+	}
+
+	searchQuery := `
+		SELECT ` + noteColumns + `, ` + highlights + `
+		FROM notes` + join + `
+		WHERE notes.user_id = ? AND ` + condition.sql
+	args = append(args, userID)
+	args = append(args, condition.args...)
+
+	if !includeTrashed {
+		searchQuery += " AND notes.deleted_at IS NULL"
+	}
+
+	searchQuery += " ORDER BY " + orderBy
+
+	rows, err := s.db.QueryContext(ctx, searchQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]types.NoteSearchResult, 0)
+	for rows.Next() {
+		var result types.NoteSearchResult
+		result.Note, err = scanNote(rows, &result.Snippet, &result.TitleHighlight)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Snippet = highlightReplacer.Replace(html.EscapeString(result.Snippet))
+		result.TitleHighlight = highlightReplacer.Replace(html.EscapeString(result.TitleHighlight))
+
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(results))
+	for i := range results {
+		ids[i] = results[i].ID
+	}
+
+	tags, err := s.getNoteTags(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Tags = tags[results[i].ID]
+	}
+
+	return results, nil
+}
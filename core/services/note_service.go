@@ -4,124 +4,223 @@ import (
 	"context"
 	"database/sql"
 	"dsn/core/database"
+	"dsn/core/logic"
 	"dsn/core/types"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 )
 
+const noteColumns = `id, user_id, title, content, color, pinned, archived, order_position, version, kind,
+	remind_at, recurrence, time_zone, created_at, updated_at, deleted_at,
+	(SELECT COUNT(*) FROM note_items WHERE note_items.note_id = notes.id AND note_items.checked),
+	(SELECT COUNT(*) FROM note_items WHERE note_items.note_id = notes.id)`
+
+// ErrVersionConflict is returned when a write expects a different version of the note than is stored.
+var ErrVersionConflict = errors.New("note has been modified")
+
 type NoteService struct {
 	db *sql.DB
 }
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNote reads the noteColumns of a row, followed by any extra selected columns.
+func scanNote(row rowScanner, extra ...any) (types.Note, error) {
+	var note types.Note
+	var progress types.Progress
+	dest := []any{
+		&note.ID, &note.UserID, &note.Title, &note.Content, &note.Color, &note.Pinned, &note.Archived,
+		&note.Order, &note.Version, &note.Kind, &note.RemindAt, &note.Recurrence, &note.TimeZone, &note.CreatedAt, &note.UpdatedAt, &note.DeletedAt,
+		&progress.Done, &progress.Total,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if note.Kind == types.NoteKindChecklist {
+		note.Progress = &progress
+	}
+	return note, err
+}
+
 func NewNoteService() *NoteService {
 	return &NoteService{db: database.DB}
 }
 
 func (s *NoteService) Create(ctx context.Context, userID int, req types.CreateNoteRequest) (*types.Note, error) {
 	query := `
-		INSERT INTO notes (user_id, title, content, color, pinned, archived, order_position) 
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-		RETURNING id, created_at, updated_at
+		INSERT INTO notes (user_id, title, content, color, pinned, archived, order_position, kind) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, version, created_at, updated_at
 	`
 
+	if req.TemplateID != 0 {
+		if err := s.applyTemplate(ctx, userID, &req, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
 	color := req.Color
 	if color == "" {
 		color = "#ffffff"
 	}
 
+	kind := req.Kind
+	if kind == "" {
+		kind = types.NoteKindText
+	}
+	if !IsValidNoteKind(kind) {
+		return nil, fmt.Errorf("unknown note kind %q", kind)
+	}
+	if len(req.Items) > 0 && kind != types.NoteKindChecklist {
+		return nil, ErrNotChecklist
+	}
+
+	content := logic.SanitizeHTML(req.Content)
+
 	var args []interface{}
-	args = append(args, userID, req.Title, req.Content, color, req.Pinned, req.Archived, req.Order)
+	args = append(args, userID, req.Title, content, color, req.Pinned, req.Archived, req.Order, kind)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
 	var note types.Note
-	err := s.db.QueryRowContext(ctx, query, args...).
-		Scan(&note.ID, &note.CreatedAt, &note.UpdatedAt)
+	err = tx.QueryRowContext(ctx, query, args...).
+		Scan(&note.ID, &note.Version, &note.CreatedAt, &note.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 
+	for i, item := range req.Items {
+		_, err := tx.ExecContext(ctx, "INSERT INTO note_items (note_id, text, checked, position) VALUES (?, ?, ?, ?)",
+			note.ID, item.Text, item.Checked, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ruled, err := runNoteRules(ctx, tx, userID, note.ID, ruleOverrides{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if ruled {
+		return s.GetByID(ctx, note.ID, userID, false)
+	}
+
 	note.UserID = userID
 	note.Title = req.Title
-	note.Content = req.Content
+	note.Content = content
 	note.Color = color
 	note.Pinned = req.Pinned
 	note.Archived = req.Archived
 	note.Order = req.Order
+	note.Kind = kind
+
+	if kind == types.NoteKindChecklist {
+		note.Items, err = getNoteItems(ctx, s.db, note.ID)
+		if err != nil {
+			return nil, err
+		}
+		note.Progress = checklistProgress(note.Items)
+	}
 
 	return &note, nil
 }
 
-func (s *NoteService) GetByID(ctx context.Context, id, userID int) (*types.Note, error) {
-	query := `
-		SELECT id, user_id, title, content, color, pinned, archived, order_position, created_at, updated_at 
-		FROM notes 
-		WHERE id = ? AND user_id = ?
-	`
-
-	var note types.Note
-	err := s.db.QueryRowContext(ctx, query, id, userID).Scan(
-		&note.ID, &note.UserID, &note.Title, &note.Content, &note.Color,
-		&note.Pinned, &note.Archived, &note.Order, &note.CreatedAt, &note.UpdatedAt,
-	)
+// Duplicate copies a note's title, content, color, kind, items and tags into a new note, which
+// is neither pinned nor archived.
+func (s *NoteService) Duplicate(ctx context.Context, id, userID int) (*types.Note, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	tags, err := s.getNoteTags(ctx, note.ID)
+	var copyID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO notes (user_id, title, content, color, order_position, kind)
+		SELECT user_id, title, content, color, order_position, kind
+		FROM notes
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+		RETURNING id
+	`, id, userID).Scan(&copyID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("note with id %d: %w", id, ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
-	note.Tags = tags
 
-	return &note, nil
+	statements := []string{
+		`INSERT INTO note_items (note_id, text, checked, position)
+		SELECT ?, text, checked, position FROM note_items WHERE note_id = ? ORDER BY position, id`,
+		"INSERT INTO note_tags (note_id, tag_id) SELECT ?, tag_id FROM note_tags WHERE note_id = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, copyID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, copyID, userID, false)
 }
 
-func (s *NoteService) GetByUserID(ctx context.Context, userID int, includeArchived bool) ([]types.Note, error) {
+func (s *NoteService) GetByID(ctx context.Context, id, userID int, includeTrashed bool) (*types.Note, error) {
 	query := `
-		SELECT id, user_id, title, content, color, pinned, archived, order_position, created_at, updated_at 
+		SELECT ` + noteColumns + `
 		FROM notes 
-		WHERE user_id = ?
+		WHERE id = ? AND user_id = ?
 	`
-	args := []interface{}{userID}
-
-	if !includeArchived {
-		query += " AND archived = FALSE"
+	if !includeTrashed {
+		query += " AND deleted_at IS NULL"
 	}
 
-	query += " ORDER BY pinned DESC, order_position ASC, updated_at DESC"
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	note, err := scanNote(s.db.QueryRowContext(ctx, query, id, userID))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	notes := make([]types.Note, 0)
-	for rows.Next() {
-		var note types.Note
-		err := rows.Scan(
-			&note.ID, &note.UserID, &note.Title, &note.Content, &note.Color,
-			&note.Pinned, &note.Archived, &note.Order, &note.CreatedAt, &note.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
+	tags, err := s.getNoteTags(ctx, []int{note.ID})
+	if err != nil {
+		return nil, err
+	}
+	note.Tags = tags[note.ID]
 
-		tags, err := s.getNoteTags(ctx, note.ID)
+	if note.Kind == types.NoteKindChecklist {
+		note.Items, err = getNoteItems(ctx, s.db, note.ID)
 		if err != nil {
 			return nil, err
 		}
-		note.Tags = tags
-
-		notes = append(notes, note)
 	}
 
-	return notes, nil
+	return &note, nil
 }
 
-func (s *NoteService) Update(ctx context.Context, id, userID int, req types.UpdateNoteRequest) (*types.Note, error) {
+// Update applies the set fields of req to a note. A non-zero expectedVersion
+// makes the update conditional on the stored version, see ErrVersionConflict.
+func (s *NoteService) Update(ctx context.Context, id, userID int, req types.UpdateNoteRequest, expectedVersion int) (*types.Note, error) {
 	var setParts []string
 	var args []interface{}
 
+	if req.Content != nil {
+		content := logic.SanitizeHTML(*req.Content)
+		req.Content = &content
+	}
+
 	if req.Title != nil {
 		setParts = append(setParts, "title = ?")
 		args = append(args, *req.Title)
@@ -148,19 +247,52 @@ func (s *NoteService) Update(ctx context.Context, id, userID int, req types.Upda
 	}
 
 	if len(setParts) == 0 {
-		return s.GetByID(ctx, id, userID)
+		note, err := s.GetByID(ctx, id, userID, false)
+		if err != nil {
+			return nil, err
+		}
+		if expectedVersion != 0 && note.Version != expectedVersion {
+			return nil, ErrVersionConflict
+		}
+		return note, nil
 	}
 
-	setParts = append(setParts, "updated_at = CURRENT_TIMESTAMP")
+	setParts = append(setParts, "version = version + 1", "updated_at = CURRENT_TIMESTAMP")
 	args = append(args, id, userID)
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previousTitle, previousContent string
+	var version int
+	err = tx.QueryRowContext(ctx, `
+		SELECT title, content, version 
+		FROM notes 
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`, id, userID).Scan(&previousTitle, &previousContent, &version)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("note with id %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != 0 && version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	// the version read above must still be stored, or the revision would record a stale title and content
 	query := fmt.Sprintf(`
 		UPDATE notes 
 		SET %s 
-		WHERE id = ? AND user_id = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL AND version = ?
 	`, strings.Join(setParts, ", "))
+	args = append(args, version)
 
-	result, err := s.db.ExecContext(ctx, query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -171,10 +303,35 @@ func (s *NoteService) Update(ctx context.Context, id, userID int, req types.Upda
 	}
 
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("note with id %d not found", id)
+		return nil, s.notUpdatedError(ctx, id, userID)
 	}
 
-	return s.GetByID(ctx, id, userID)
+	title, content := previousTitle, previousContent
+	if req.Title != nil {
+		title = *req.Title
+	}
+	if req.Content != nil {
+		content = *req.Content
+	}
+
+	if title != previousTitle || content != previousContent {
+		previous := types.NoteRevision{NoteID: id, Title: previousTitle, Content: previousContent}
+		current := types.NoteRevision{NoteID: id, Title: title, Content: content}
+		if err := recordRevision(ctx, tx, userID, previous, current); err != nil {
+			return nil, err
+		}
+	}
+
+	overrides := ruleOverrides{color: req.Color != nil, pinned: req.Pinned != nil, archived: req.Archived != nil}
+	if _, err := runNoteRules(ctx, tx, userID, id, overrides); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, id, userID, false)
 }
 
 func (s *NoteService) UpdateOrder(ctx context.Context, userID int, noteOrders map[int]int) error {
@@ -188,7 +345,7 @@ func (s *NoteService) UpdateOrder(ctx context.Context, userID int, noteOrders ma
 		_, err := tx.Exec(`
 			UPDATE notes 
 			SET order_position = ?, updated_at = CURRENT_TIMESTAMP 
-			WHERE id = ? AND user_id = ?
+			WHERE id = ? AND user_id = ? AND deleted_at IS NULL
 		`, order, noteID, userID)
 		if err != nil {
 			return err
@@ -198,8 +355,14 @@ func (s *NoteService) UpdateOrder(ctx context.Context, userID int, noteOrders ma
 	return tx.Commit()
 }
 
+// Delete moves a note to the trash, it is removed for good by DeletePermanently
+// or once it has been in the trash longer than the retention period.
 func (s *NoteService) Delete(ctx context.Context, id, userID int) error {
-	query := "DELETE FROM notes WHERE id = ? AND user_id = ?"
+	query := `
+		UPDATE notes 
+		SET deleted_at = CURRENT_TIMESTAMP 
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`
 	result, err := s.db.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return err
@@ -211,58 +374,115 @@ func (s *NoteService) Delete(ctx context.Context, id, userID int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("note with id %d not found", id)
+		return fmt.Errorf("note with id %d: %w", id, ErrNotFound)
 	}
 
 	return nil
 }
 
-func (s *NoteService) Search(ctx context.Context, userID int, query string) ([]types.Note, error) {
-	searchQuery := `
-		SELECT id, user_id, title, content, color, pinned, archived, order_position, created_at, updated_at 
+func (s *NoteService) GetTrash(ctx context.Context, userID int) ([]types.Note, error) {
+	query := `
+		SELECT ` + noteColumns + `
 		FROM notes 
-		WHERE user_id = ? AND (title LIKE ? OR content LIKE ?)
-		ORDER BY pinned DESC, order_position ASC, updated_at DESC
+		WHERE user_id = ? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
 	`
 
-	searchTerm := "%" + query + "%"
-	rows, err := s.db.QueryContext(ctx, searchQuery, userID, searchTerm, searchTerm)
+	return s.queryNotes(ctx, query, userID)
+}
+
+func (s *NoteService) Restore(ctx context.Context, id, userID int) (*types.Note, error) {
+	query := `
+		UPDATE notes 
+		SET deleted_at = NULL 
+		WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL
+	`
+	result, err := s.db.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	notes := make([]types.Note, 0)
-	for rows.Next() {
-		var note types.Note
-		err := rows.Scan(
-			&note.ID, &note.UserID, &note.Title, &note.Content, &note.Color,
-			&note.Pinned, &note.Archived, &note.Order, &note.CreatedAt, &note.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
 
-		tags, err := s.getNoteTags(ctx, note.ID)
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("note with id %d not found in trash", id)
+	}
+
+	return s.GetByID(ctx, id, userID, false)
+}
+
+func (s *NoteService) DeletePermanently(ctx context.Context, id, userID int) error {
+	query := "DELETE FROM notes WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL"
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("note with id %d not found in trash", id)
+	}
+
+	return nil
+}
+
+func (s *NoteService) EmptyTrash(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM notes WHERE user_id = ? AND deleted_at IS NOT NULL", userID)
+	return err
+}
+
+// PurgeTrash permanently deletes notes that have been in the trash for longer than retention.
+func (s *NoteService) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM notes 
+		WHERE deleted_at IS NOT NULL AND deleted_at <= datetime('now', ?)
+	`
+	modifier := fmt.Sprintf("-%d seconds", int64(retention.Seconds()))
+
+	result, err := s.db.ExecContext(ctx, query, modifier)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// StartTrashPurge runs PurgeTrash every interval until ctx is cancelled.
+func (s *NoteService) StartTrashPurge(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeTrash(ctx, retention)
 		if err != nil {
-			return nil, err
+			log.Printf("Error purging trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d notes from trash", purged)
 		}
-		note.Tags = tags
 
-		notes = append(notes, note)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-
-	return notes, nil
 }
 
-func (s *NoteService) TogglePin(ctx context.Context, id, userID int, pinned bool) (*types.Note, error) {
+func (s *NoteService) TogglePin(ctx context.Context, id, userID int, pinned bool, expectedVersion int) (*types.Note, error) {
 	query := `
 		UPDATE notes 
-		SET pinned = ?, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = ? AND user_id = ?
+		SET pinned = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
 	`
 
-	result, err := s.db.ExecContext(ctx, query, pinned, id, userID)
+	result, err := s.db.ExecContext(ctx, query, pinned, id, userID, expectedVersion, expectedVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -273,20 +493,20 @@ func (s *NoteService) TogglePin(ctx context.Context, id, userID int, pinned bool
 	}
 
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("note with id %d not found", id)
+		return nil, s.notUpdatedError(ctx, id, userID)
 	}
 
-	return s.GetByID(ctx, id, userID)
+	return s.GetByID(ctx, id, userID, false)
 }
 
-func (s *NoteService) ToggleArchive(ctx context.Context, id, userID int, archived bool) (*types.Note, error) {
+func (s *NoteService) ToggleArchive(ctx context.Context, id, userID int, archived bool, expectedVersion int) (*types.Note, error) {
 	query := `
 		UPDATE notes 
-		SET archived = ?, updated_at = CURRENT_TIMESTAMP 
-		WHERE id = ? AND user_id = ?
+		SET archived = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
 	`
 
-	result, err := s.db.ExecContext(ctx, query, archived, id, userID)
+	result, err := s.db.ExecContext(ctx, query, archived, id, userID, expectedVersion, expectedVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -297,40 +517,240 @@ func (s *NoteService) ToggleArchive(ctx context.Context, id, userID int, archive
 	}
 
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("note with id %d not found", id)
+		return nil, s.notUpdatedError(ctx, id, userID)
 	}
 
-	return s.GetByID(ctx, id, userID)
+	return s.GetByID(ctx, id, userID, false)
 }
 
-func (s *NoteService) getNoteTags(ctx context.Context, noteID int) ([]types.Tag, error) {
-	query := `
-		SELECT t.id, t.name, t.color, t.created_at
-		FROM tags t
-		JOIN note_tags nt ON t.id = nt.tag_id
-		WHERE nt.note_id = ?
-		ORDER BY t.name
-	`
+// Convert switches a note between text and checklist. A text note becomes one item per line
+// of its content, and a checklist becomes a list with checked items struck through.
+// The replaced content is kept as a revision, see RevisionService.
+func (s *NoteService) Convert(ctx context.Context, id, userID int, kind string, expectedVersion int) (*types.Note, error) {
+	if !IsValidNoteKind(kind) {
+		return nil, fmt.Errorf("unknown note kind %q", kind)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var title, content, currentKind string
+	var version int
+	err = tx.QueryRowContext(ctx, `
+		SELECT title, content, kind, version
+		FROM notes
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`, id, userID).Scan(&title, &content, &currentKind, &version)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("note with id %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != 0 && version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	if kind == currentKind {
+		return s.GetByID(ctx, id, userID, false)
+	}
+
+	var newContent string
+	if kind == types.NoteKindChecklist {
+		for i, line := range logic.HTMLToChecklist(content) {
+			_, err := tx.ExecContext(ctx, "INSERT INTO note_items (note_id, text, checked, position) VALUES (?, ?, ?, ?)",
+				id, line.Text, line.Checked, i)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		items, err := getNoteItems(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		lines := make([]logic.ChecklistLine, len(items))
+		for i, item := range items {
+			lines[i] = logic.ChecklistLine{Text: item.Text, Checked: item.Checked}
+		}
+		newContent = logic.ChecklistToHTML(lines)
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM note_items WHERE note_id = ?", id); err != nil {
+			return nil, err
+		}
+	}
 
-	rows, err := s.db.QueryContext(ctx, query, noteID)
+	_, err = tx.ExecContext(ctx, `
+		UPDATE notes
+		SET kind = ?, content = ?, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, kind, newContent, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if newContent != content {
+		previous := types.NoteRevision{NoteID: id, Title: title, Content: content}
+		current := types.NoteRevision{NoteID: id, Title: title, Content: newContent}
+		if err := recordRevision(ctx, tx, userID, previous, current); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, id, userID, false)
+}
+
+// SanitizeAll re-sanitizes the content of every note and revision, for rows written before
+// content was sanitized on save. It returns the number of rows that changed.
+func (s *NoteService) SanitizeAll(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	changed := 0
+	for _, table := range []string{"notes", "note_revisions"} {
+		rows, err := tx.QueryContext(ctx, "SELECT id, content FROM "+table)
+		if err != nil {
+			return 0, err
+		}
+
+		sanitized := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var content string
+			if err := rows.Scan(&id, &content); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			if clean := logic.SanitizeHTML(content); clean != content {
+				sanitized[id] = clean
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for id, content := range sanitized {
+			if _, err := tx.ExecContext(ctx, "UPDATE "+table+" SET content = ? WHERE id = ?", content, id); err != nil {
+				return 0, err
+			}
+		}
+		changed += len(sanitized)
+	}
+
+	return changed, tx.Commit()
+}
+
+// notUpdatedError tells apart a conditional write that lost against a newer
+// version from one that targeted a missing note.
+func (s *NoteService) notUpdatedError(ctx context.Context, id, userID int) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM notes WHERE id = ? AND user_id = ? AND deleted_at IS NULL)
+	`, id, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrVersionConflict
+	}
+
+	return fmt.Errorf("note with id %d: %w", id, ErrNotFound)
+}
+
+func (s *NoteService) queryNotes(ctx context.Context, query string, args ...interface{}) ([]types.Note, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	tags := make([]types.Tag, 0)
+	notes := make([]types.Note, 0)
 	for rows.Next() {
-		var tag types.Tag
-		err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt)
+		note, err := scanNote(rows)
 		if err != nil {
 			return nil, err
 		}
-		tags = append(tags, tag)
+		notes = append(notes, note)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
+	ids := make([]int, len(notes))
+	for i := range notes {
+		ids[i] = notes[i].ID
+	}
+
+	tags, err := s.getNoteTags(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		notes[i].Tags = tags[notes[i].ID]
+	}
+
+	return notes, nil
+}
+
+// tagQueryBatchSize keeps the number of bound parameters in one query well under SQLite's limit.
+const tagQueryBatchSize = 500
+
+// getNoteTags loads the tags of many notes at once, keyed by note id, in one query per batch
+// rather than one per note.
+func (s *NoteService) getNoteTags(ctx context.Context, noteIDs []int) (map[int][]types.Tag, error) {
+	tags := make(map[int][]types.Tag, len(noteIDs))
+
+	for start := 0; start < len(noteIDs); start += tagQueryBatchSize {
+		batch := noteIDs[start:min(start+tagQueryBatchSize, len(noteIDs))]
+
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		query := `
+			SELECT nt.note_id, t.id, t.parent_id, t.name, t.color, t.created_at
+			FROM tags t
+			JOIN note_tags nt ON t.id = nt.tag_id
+			WHERE nt.note_id IN (?` + strings.Repeat(", ?", len(batch)-1) + `)
+			ORDER BY nt.note_id, t.name
+		`
+
+		rows, err := s.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var noteID int
+			var tag types.Tag
+			if err := rows.Scan(&noteID, &tag.ID, &tag.ParentID, &tag.Name, &tag.Color, &tag.CreatedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			tags[noteID] = append(tags[noteID], tag)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
 	return tags, nil
 }
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"dsn/core/database"
+	"dsn/core/types"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNoteUpdateVersion(t *testing.T) {
+	ctx := context.Background()
+	notes := NewNoteService()
+	owner := createTestUser(t, "note-version")
+	other := createTestUser(t, "note-version-other")
+
+	note, err := notes.Create(ctx, owner.ID, types.CreateNoteRequest{Title: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	title := "second"
+	updated, err := notes.Update(ctx, note.ID, owner.ID, types.UpdateNoteRequest{Title: &title}, note.Version)
+	if err != nil {
+		t.Fatalf("Update at the current version: %v", err)
+	}
+	if updated.Version != note.Version+1 || updated.Title != title {
+		t.Errorf("Update gave version %d titled %q, want version %d titled %q", updated.Version, updated.Title, note.Version+1, title)
+	}
+
+	stale := "stale"
+	if _, err := notes.Update(ctx, note.ID, owner.ID, types.UpdateNoteRequest{Title: &stale}, note.Version); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Update at a stale version: got %v, want ErrVersionConflict", err)
+	}
+	if _, err := notes.Update(ctx, note.ID, other.ID, types.UpdateNoteRequest{Title: &stale}, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of another user's note: got %v, want ErrNotFound", err)
+	}
+
+	current, err := notes.GetByID(ctx, note.ID, owner.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Title != title || current.Version != updated.Version {
+		t.Errorf("refused updates changed the note to version %d titled %q", current.Version, current.Title)
+	}
+}
+
+// BenchmarkGetNoteTags loads the tags of note lists around and above tagQueryBatchSize, batched
+// as getNoteTags does, and with one query per note as listing did before. SQLite runs interpreted
+// under TestMain, so the numbers are for comparing with each other rather than with a server.
+func BenchmarkGetNoteTags(b *testing.B) {
+	const tagsPerNote = 3
+	noteIDs := seedTaggedNotes(b, "bench-note-tags", 5000, tagsPerNote)
+	notes := NewNoteService()
+
+	check := func(b *testing.B, tags map[int][]types.Tag, count int) {
+		if len(tags) != count || len(tags[noteIDs[0]]) != tagsPerNote {
+			b.Fatalf("got tags for %d notes, want %d with %d each", len(tags), count, tagsPerNote)
+		}
+	}
+
+	for _, count := range []int{1, 100, tagQueryBatchSize, tagQueryBatchSize + 1, 2000, 5000} {
+		b.Run(fmt.Sprintf("notes=%d/batched", count), func(b *testing.B) {
+			ctx := context.Background()
+			for b.Loop() {
+				tags, err := notes.getNoteTags(ctx, noteIDs[:count])
+				if err != nil {
+					b.Fatal(err)
+				}
+				check(b, tags, count)
+			}
+		})
+
+		b.Run(fmt.Sprintf("notes=%d/per-note", count), func(b *testing.B) {
+			ctx := context.Background()
+			for b.Loop() {
+				tags := make(map[int][]types.Tag, count)
+				for _, id := range noteIDs[:count] {
+					noteTags, err := notes.getNoteTags(ctx, []int{id})
+					if err != nil {
+						b.Fatal(err)
+					}
+					tags[id] = noteTags[id]
+				}
+				check(b, tags, count)
+			}
+		})
+	}
+}
+
+// BenchmarkListPage lists a 500 note page out of 5000 tagged notes, the path getNoteTags batches.
+func BenchmarkListPage(b *testing.B) {
+	const pageSize = 500
+	seedTaggedNotes(b, "bench-list-page", 5000, 3)
+	user, err := NewUserService().GetByUsername("bench-list-page")
+	if err != nil {
+		b.Fatal(err)
+	}
+	notes := NewNoteService()
+
+	ctx := context.Background()
+	for b.Loop() {
+		page, err := notes.List(ctx, user.ID, types.NoteListOptions{Limit: pageSize})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(page.Notes) != pageSize || len(page.Notes[0].Tags) != 3 {
+			b.Fatalf("got %d notes, want %d with 3 tags each", len(page.Notes), pageSize)
+		}
+	}
+}
+
+// seedTaggedNotes inserts count notes for a new user, each with tagsPerNote tags, in one
+// transaction and returns their ids.
+func seedTaggedNotes(b *testing.B, username string, count, tagsPerNote int) []int {
+	b.Helper()
+
+	ctx := context.Background()
+	user := createTestUser(b, username)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	tagIDs := make([]int64, tagsPerNote)
+	for i := range tagIDs {
+		result, err := tx.ExecContext(ctx, "INSERT INTO tags (user_id, name) VALUES (?, ?)", user.ID, fmt.Sprintf("tag %d", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if tagIDs[i], err = result.LastInsertId(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	noteIDs := make([]int, count)
+	for i := range noteIDs {
+		result, err := tx.ExecContext(ctx, "INSERT INTO notes (user_id, title, content) VALUES (?, ?, ?)",
+			user.ID, fmt.Sprintf("note %d", i), "<p>seeded</p>")
+		if err != nil {
+			b.Fatal(err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			b.Fatal(err)
+		}
+		noteIDs[i] = int(id)
+
+		for _, tagID := range tagIDs {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO note_tags (note_id, tag_id) VALUES (?, ?)", id, tagID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return noteIDs
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"dsn/core/database"
+	"dsn/core/logic"
+	"dsn/core/types"
+	"fmt"
+	"log"
+	"time"
+)
+
+type ReminderService struct {
+	db *sql.DB
+}
+
+func NewReminderService() *ReminderService {
+	return &ReminderService{db: database.DB}
+}
+
+// GetDue returns a user's fired reminders that have not been dismissed, oldest first.
+// Polling with the last id seen as afterID returns only reminders fired since.
+func (s *ReminderService) GetDue(ctx context.Context, userID, afterID int) ([]types.DueReminder, error) {
+	query := `
+		SELECT r.id, r.note_id, n.title, r.due_at, r.fired_at
+		FROM due_reminders r
+		JOIN notes n ON n.id = r.note_id
+		WHERE r.user_id = ? AND r.id > ? AND n.deleted_at IS NULL
+		ORDER BY r.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := make([]types.DueReminder, 0)
+	for rows.Next() {
+		var reminder types.DueReminder
+		err := rows.Scan(&reminder.ID, &reminder.NoteID, &reminder.Title, &reminder.DueAt, &reminder.FiredAt)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+func (s *ReminderService) Dismiss(ctx context.Context, id, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM due_reminders WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("reminder with id %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// FireDue fires every reminder due at or before now. A fired reminder replaces any earlier one
+// of the same note still waiting to be dismissed, and a recurring one moves on to its next
+// occurrence after now, so occurrences missed while the server was down fire only once.
+func (s *ReminderService) FireDue(ctx context.Context, now time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	type dueNote struct {
+		id         int
+		userID     int
+		remindAt   time.Time
+		recurrence string
+		timeZone   string
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, remind_at, recurrence, time_zone
+		FROM notes
+		WHERE remind_at IS NOT NULL AND remind_at <= ? AND deleted_at IS NULL
+	`, now.UTC().Format(sqliteTimeFormat))
+	if err != nil {
+		return 0, err
+	}
+
+	var due []dueNote
+	for rows.Next() {
+		var note dueNote
+		if err := rows.Scan(&note.id, &note.userID, &note.remindAt, &note.recurrence, &note.timeZone); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, note)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, note := range due {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM due_reminders WHERE note_id = ?", note.id); err != nil {
+			return 0, err
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO due_reminders (note_id, user_id, due_at) VALUES (?, ?, ?)",
+			note.id, note.userID, note.remindAt.UTC().Format(sqliteTimeFormat))
+		if err != nil {
+			return 0, err
+		}
+
+		var next any
+		if note.recurrence != "" {
+			recurrence, err := logic.ParseRecurrence(note.recurrence)
+			if err != nil {
+				log.Printf("Invalid recurrence %q on note %d: %v", note.recurrence, note.id, err)
+			} else if occurrence, ok := recurrence.NextAfter(note.remindAt.In(reminderLocation(note.id, note.timeZone)), now); ok {
+				next = occurrence.UTC().Format(sqliteTimeFormat)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE notes SET remind_at = ? WHERE id = ?", next, note.id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(due), tx.Commit()
+}
+
+// reminderLocation returns the time zone a note's reminder repeats in, so its weekdays and
+// wall clock time follow the user's calendar rather than UTC across daylight saving changes.
+func reminderLocation(noteID int, timeZone string) *time.Location {
+	if timeZone == "" {
+		return time.UTC
+	}
+	location, err := logic.LoadTimeZone(timeZone)
+	if err != nil {
+		log.Printf("Invalid time zone %q on note %d, using UTC: %v", timeZone, noteID, err)
+		return time.UTC
+	}
+	return location
+}
+
+// StartScheduler runs FireDue every interval until ctx is cancelled.
+func (s *ReminderService) StartScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fired, err := s.FireDue(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error firing reminders: %v", err)
+		} else if fired > 0 {
+			log.Printf("Fired %d reminders", fired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
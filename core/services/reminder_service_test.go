@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"dsn/core/types"
+	"testing"
+	"time"
+)
+
+func TestFireDueRepeatsInTheReminderTimeZone(t *testing.T) {
+	ctx := context.Background()
+	notes := NewNoteService()
+	reminders := NewReminderService()
+	user := createTestUser(t, "reminder-zone")
+
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Monday evening in Los Angeles is Tuesday morning in UTC
+	remindAt := time.Date(2026, 10, 19, 20, 0, 0, 0, losAngeles)
+
+	tests := []struct {
+		timeZone string
+		want     time.Time
+	}{
+		{"America/Los_Angeles", time.Date(2026, 10, 26, 20, 0, 0, 0, losAngeles)},
+		{"", time.Date(2026, 10, 26, 3, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		note, err := notes.Create(ctx, user.ID, types.CreateNoteRequest{Title: "weekly"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := notes.SetReminder(ctx, note.ID, user.ID, remindAt, "FREQ=WEEKLY;BYDAY=MO", tt.timeZone); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := reminders.FireDue(ctx, remindAt.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	upcoming, err := notes.UpcomingReminders(ctx, user.ID, remindAt.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(upcoming) != len(tests) {
+		t.Fatalf("got %d upcoming reminders, want %d", len(upcoming), len(tests))
+	}
+
+	for _, note := range upcoming {
+		for _, tt := range tests {
+			if note.TimeZone == tt.timeZone && !note.RemindAt.Equal(tt.want) {
+				t.Errorf("reminder in zone %q moved to %s, want %s", tt.timeZone, note.RemindAt, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"dsn/core/config"
+	"dsn/core/database"
+	"dsn/core/logic"
+	"dsn/core/types"
+	"fmt"
+	"regexp"
+)
+
+// revisionsKeptPerNote is how many of a note's newest revisions survive pruning, whatever the
+// user's revision limit
+const revisionsKeptPerNote = 10
+
+// block level closing tags get a line break after them so diffs of note html are line based
+var blockEndPattern = regexp.MustCompile(`(?i)(</(p|li|h[1-6]|blockquote|pre|ul|ol|div)>|<br\s*/?>)`)
+
+type RevisionService struct {
+	db *sql.DB
+}
+
+func NewRevisionService() *RevisionService {
+	return &RevisionService{db: database.DB}
+}
+
+func (s *RevisionService) GetByNoteID(ctx context.Context, noteID, userID int) ([]types.NoteRevision, error) {
+	query := `
+		SELECT id, note_id, revision, title, content, created_at
+		FROM note_revisions
+		WHERE note_id = ? AND user_id = ?
+		ORDER BY revision DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]types.NoteRevision, 0)
+	for rows.Next() {
+		var revision types.NoteRevision
+		err := rows.Scan(&revision.ID, &revision.NoteID, &revision.Revision, &revision.Title, &revision.Content, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// a note without revisions answers an empty list, someone else's note is not found
+	if len(revisions) == 0 {
+		var exists bool
+		err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM notes WHERE id = ? AND user_id = ?)", noteID, userID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("note with id %d: %w", noteID, ErrNotFound)
+		}
+	}
+
+	return revisions, nil
+}
+
+func (s *RevisionService) Get(ctx context.Context, noteID, userID, revisionNumber int) (*types.NoteRevision, error) {
+	query := `
+		SELECT id, note_id, revision, title, content, created_at
+		FROM note_revisions
+		WHERE note_id = ? AND user_id = ? AND revision = ?
+	`
+
+	var revision types.NoteRevision
+	err := s.db.QueryRowContext(ctx, query, noteID, userID, revisionNumber).Scan(
+		&revision.ID, &revision.NoteID, &revision.Revision, &revision.Title, &revision.Content, &revision.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (s *RevisionService) Diff(ctx context.Context, noteID, userID, from, to int) (*types.NoteRevisionDiff, error) {
+	fromRevision, err := s.Get(ctx, noteID, userID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRevision, err := s.Get(ctx, noteID, userID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := logic.UnifiedDiff(
+		fmt.Sprintf("revision %d", from),
+		fmt.Sprintf("revision %d", to),
+		revisionDiffText(fromRevision),
+		revisionDiffText(toRevision),
+	)
+
+	return &types.NoteRevisionDiff{
+		NoteID: noteID,
+		From:   from,
+		To:     to,
+		Diff:   diff,
+	}, nil
+}
+
+func revisionDiffText(revision *types.NoteRevision) string {
+	return revision.Title + "\n\n" + blockEndPattern.ReplaceAllString(revision.Content, "$1\n")
+}
+
+// recordRevision stores current as the next revision of a note. Notes edited
+// before revisions existed get their previous state recorded first.
+func recordRevision(ctx context.Context, tx *sql.Tx, userID int, previous, current types.NoteRevision) error {
+	var latest int
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(revision), 0) FROM note_revisions WHERE note_id = ?", current.NoteID).Scan(&latest)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO note_revisions (note_id, user_id, revision, title, content)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	if latest == 0 {
+		latest++
+		_, err = tx.ExecContext(ctx, insertQuery, previous.NoteID, userID, latest, previous.Title, previous.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, insertQuery, current.NoteID, userID, latest+1, current.Title, current.Content)
+	if err != nil {
+		return err
+	}
+
+	return pruneRevisions(ctx, tx, userID)
+}
+
+// pruneRevisions keeps the newest revisions of a user, up to the configured limit, and always the
+// newest revisionsKeptPerNote of each note, so one busy note can't evict the history of the others.
+// A note's latest revision is never pruned, which keeps its numbering going.
+func pruneRevisions(ctx context.Context, tx *sql.Tx, userID int) error {
+	if config.RevisionLimit <= 0 {
+		return nil
+	}
+
+	query := `
+		DELETE FROM note_revisions
+		WHERE id IN (
+			SELECT id FROM (
+				SELECT id,
+					ROW_NUMBER() OVER (ORDER BY id DESC) AS user_rank,
+					ROW_NUMBER() OVER (PARTITION BY note_id ORDER BY revision DESC) AS note_rank
+				FROM note_revisions
+				WHERE user_id = ?
+			)
+			WHERE user_rank > ? AND note_rank > ?
+		)
+	`
+	_, err := tx.ExecContext(ctx, query, userID, config.RevisionLimit, revisionsKeptPerNote)
+	return err
+}
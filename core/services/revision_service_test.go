@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"dsn/core/config"
+	"dsn/core/types"
+	"fmt"
+	"testing"
+)
+
+func TestPruneRevisionsKeepsEveryNotesHistory(t *testing.T) {
+	ctx := context.Background()
+	notes := NewNoteService()
+	revisions := NewRevisionService()
+	user := createTestUser(t, "revision-prune")
+
+	limit := config.RevisionLimit
+	config.RevisionLimit = 15
+	t.Cleanup(func() { config.RevisionLimit = limit })
+
+	rename := func(note *types.Note, times int) {
+		t.Helper()
+		for i := range times {
+			title := fmt.Sprintf("%s %d", note.Title, i)
+			if _, err := notes.Update(ctx, note.ID, user.ID, types.UpdateNoteRequest{Title: &title}, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	quiet, err := notes.Create(ctx, user.ID, types.CreateNoteRequest{Title: "quiet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy, err := notes.Create(ctx, user.ID, types.CreateNoteRequest{Title: "busy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rename(quiet, 3)
+	rename(busy, 40)
+
+	quietRevisions, err := revisions.GetByNoteID(ctx, quiet.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quietRevisions) != 4 {
+		t.Errorf("quiet note kept %d revisions, want all 4", len(quietRevisions))
+	}
+
+	busyRevisions, err := revisions.GetByNoteID(ctx, busy.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(busyRevisions) != config.RevisionLimit {
+		t.Errorf("busy note kept %d revisions, want %d", len(busyRevisions), config.RevisionLimit)
+	}
+	if busyRevisions[0].Revision != 41 {
+		t.Errorf("busy note's latest revision is %d, want 41", busyRevisions[0].Revision)
+	}
+
+	// the busy note drops to its own share once the quiet note takes the user's newest revisions
+	rename(quiet, 20)
+	quietRevisions, err = revisions.GetByNoteID(ctx, quiet.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busyRevisions, err = revisions.GetByNoteID(ctx, busy.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(busyRevisions) != revisionsKeptPerNote || busyRevisions[0].Revision != 41 {
+		t.Errorf("busy note kept %d revisions up to %d, want %d up to 41", len(busyRevisions), busyRevisions[0].Revision, revisionsKeptPerNote)
+	}
+	if len(quietRevisions) != config.RevisionLimit || quietRevisions[0].Revision != 24 {
+		t.Errorf("quiet note kept %d revisions up to %d, want %d up to 24", len(quietRevisions), quietRevisions[0].Revision, config.RevisionLimit)
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QueryError reports a search query that could not be parsed, pointing at the offending token.
+type QueryError struct {
+	Message  string
+	Token    string
+	Position int
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d: %s", e.Message, e.Position, e.Token)
+}
+
+type searchTokenKind int
+
+const (
+	tokenText searchTokenKind = iota
+	tokenQualifier
+	tokenOr
+)
+
+var searchQualifiers = map[string]bool{
+	"tag":    true,
+	"color":  true,
+	"is":     true,
+	"has":    true,
+	"before": true,
+	"after":  true,
+}
+
+type searchToken struct {
+	kind     searchTokenKind
+	negated  bool
+	phrase   bool
+	key      string
+	value    string
+	raw      string
+	position int
+}
+
+// searchCondition is a parsed search query as a parameterised SQL condition on the notes table.
+type searchCondition struct {
+	sql  string
+	args []any
+	// text terms that are not negated, used to rank and highlight the results
+	matchTerms []string
+}
+
+// parseSearchQuery parses the search grammar:
+//
+//	words "quoted phrases" prefix*   full-text terms, all of which must match
+//	tag:work color:#fef3c7           notes with a tag or color
+//	is:pinned is:archived has:image  note state and content
+//	before:2026-01-01 after:...      created before or on/after a date
+//	-term                            excludes notes matching term
+//	a OR b                           either side matches, binds looser than the implicit AND
+func parseSearchQuery(input string) (*searchCondition, error) {
+	tokens, err := tokenizeSearchQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &QueryError{Message: "empty query", Position: 0}
+	}
+
+	var alternatives []string
+	condition := &searchCondition{}
+
+	var terms []string
+	for i, token := range tokens {
+		if token.kind == tokenOr {
+			if len(terms) == 0 || i == len(tokens)-1 {
+				return nil, &QueryError{Message: "OR needs a term on both sides", Token: token.raw, Position: token.position}
+			}
+			alternatives = append(alternatives, strings.Join(terms, " AND "))
+			terms = nil
+			continue
+		}
+
+		term, args, err := searchTokenCondition(token)
+		if err != nil {
+			return nil, err
+		}
+		if token.negated {
+			term = "NOT " + term
+		} else if token.kind == tokenText {
+			condition.matchTerms = append(condition.matchTerms, ftsTerm(token))
+		}
+
+		terms = append(terms, term)
+		condition.args = append(condition.args, args...)
+	}
+	alternatives = append(alternatives, strings.Join(terms, " AND "))
+
+	condition.sql = "((" + strings.Join(alternatives, ") OR (") + "))"
+	return condition, nil
+}
+
+func searchTokenCondition(token searchToken) (string, []any, error) {
+	invalid := func(message string) error {
+		return &QueryError{Message: message, Token: token.raw, Position: token.position}
+	}
+
+	if token.kind == tokenText {
+		return "notes.id IN (SELECT rowid FROM notes_fts WHERE notes_fts MATCH ?)", []any{ftsTerm(token)}, nil
+	}
+
+	if token.value == "" {
+		return "", nil, invalid(fmt.Sprintf("%s: needs a value", token.key))
+	}
+
+	switch token.key {
+	case "tag":
+		// a note carries only its owner's tags, so the subtree of every user's tag of this name can be searched
+		return `EXISTS (
+			SELECT 1 FROM note_tags nt
+			WHERE nt.note_id = notes.id AND nt.tag_id IN (` + tagSubtreeQuery("SELECT id FROM tags WHERE name = ? COLLATE NOCASE") + `)
+		)`, []any{token.value}, nil
+	case "color":
+		return "notes.color = ? COLLATE NOCASE", []any{token.value}, nil
+	case "is":
+		switch strings.ToLower(token.value) {
+		case "pinned":
+			return "notes.pinned = TRUE", nil, nil
+		case "archived":
+			return "notes.archived = TRUE", nil, nil
+		}
+		return "", nil, invalid("is: must be pinned or archived")
+	case "has":
+		if strings.ToLower(token.value) == "image" {
+			return "notes.content LIKE ?", []any{"%<img%"}, nil
+		}
+		return "", nil, invalid("has: must be image")
+	case "before", "after":
+		date, err := time.Parse(time.DateOnly, token.value)
+		if err != nil {
+			return "", nil, invalid(token.key + ": must be a date like 2026-01-01")
+		}
+		if token.key == "before" {
+			return "notes.created_at < ?", []any{date.Format(sqliteTimeFormat)}, nil
+		}
+		return "notes.created_at >= ?", []any{date.Format(sqliteTimeFormat)}, nil
+	}
+
+	return "", nil, invalid("unknown qualifier")
+}
+
+// ftsTerm quotes a text token as an FTS5 string so user input can never be read as FTS syntax.
+func ftsTerm(token searchToken) string {
+	value := token.value
+	prefix := false
+	if !token.phrase && strings.HasSuffix(value, "*") {
+		value = strings.TrimRight(value, "*")
+		prefix = true
+	}
+
+	term := `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+	if prefix {
+		term += "*"
+	}
+	return term
+}
+
+func tokenizeSearchQuery(input string) ([]searchToken, error) {
+	var tokens []searchToken
+
+	position := 0
+	for position < len(input) {
+		r, size := utf8.DecodeRuneInString(input[position:])
+		if unicode.IsSpace(r) {
+			position += size
+			continue
+		}
+
+		token := searchToken{position: position}
+		start := position
+
+		if input[position] == '-' {
+			token.negated = true
+			position++
+		}
+
+		if position < len(input) && input[position] == '"' {
+			value, end, ok := readQuoted(input, position)
+			if !ok {
+				return nil, &QueryError{Message: "unterminated quote", Token: input[start:], Position: start}
+			}
+			token.kind = tokenText
+			token.phrase = true
+			token.value = value
+			position = end
+		} else {
+			end := position
+			for end < len(input) {
+				r, size := utf8.DecodeRuneInString(input[end:])
+				if unicode.IsSpace(r) {
+					break
+				}
+				// a quoted qualifier value may contain spaces, as in tag:"to do"
+				if r == '"' && end > position && input[end-1] == ':' {
+					_, quoteEnd, ok := readQuoted(input, end)
+					if !ok {
+						return nil, &QueryError{Message: "unterminated quote", Token: input[start:], Position: start}
+					}
+					end = quoteEnd
+					break
+				}
+				end += size
+			}
+
+			word := input[position:end]
+			position = end
+
+			key, value, isQualifier := strings.Cut(word, ":")
+			switch {
+			case word == "OR" && !token.negated:
+				token.kind = tokenOr
+			case isQualifier && searchQualifiers[strings.ToLower(key)]:
+				token.kind = tokenQualifier
+				token.key = strings.ToLower(key)
+				token.value = value
+				if strings.HasPrefix(value, `"`) {
+					token.value, _, _ = readQuoted(value, 0)
+				}
+			default:
+				token.kind = tokenText
+				token.value = word
+			}
+		}
+
+		token.raw = input[start:position]
+
+		if token.kind == tokenText && !hasSearchableText(token.value) {
+			return nil, &QueryError{Message: "search term has no letters or digits", Token: token.raw, Position: start}
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// readQuoted reads the quoted string starting at input[start], returning its contents and the position after it.
+func readQuoted(input string, start int) (string, int, bool) {
+	end := strings.IndexByte(input[start+1:], '"')
+	if end < 0 {
+		return "", len(input), false
+	}
+	return input[start+1 : start+1+end], start + end + 2, true
+}
+
+func hasSearchableText(text string) bool {
+	return strings.ContainsFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) })
+}
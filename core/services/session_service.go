@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"dsn/core/types"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// ErrRefreshTokenReused means a refresh token was presented after it had been rotated, so it
+// may have been stolen. Its whole session is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// SessionRefresh is a session and the refresh token that continues it.
+type SessionRefresh struct {
+	SessionID    string
+	UserID       int
+	RefreshToken string
+}
+
+// GetSessions returns the user's unexpired sessions, most recently seen first, marking currentID.
+func (s *AuthService) GetSessions(ctx context.Context, userID int, currentID string) ([]types.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC, created_at DESC
+	`, userID, time.Now().UTC().Format(sqliteTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]types.Session, 0)
+	for rows.Next() {
+		var session types.Session
+		err := rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		session.Current = session.ID == currentID
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs one of the user's sessions out.
+func (s *AuthService) RevokeSession(ctx context.Context, id string, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("session with id %s: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// RevokeSessions logs all of the user's sessions out except exceptID, which may be empty, and
+// returns how many it revoked.
+func (s *AuthService) RevokeSessions(ctx context.Context, userID int, exceptID string) (int, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = ? AND id != ?", userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return int(rowsAffected), err
+}
+
+// CreateSession logs the user in on the device r came from and returns the session with its
+// first refresh token. Access tokens for it come from GenerateToken.
+func (s *AuthService) CreateSession(r *http.Request, userID int) (*SessionRefresh, error) {
+	ctx := r.Context()
+	now := time.Now().UTC()
+
+	sessionID, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= ?", now.Format(sqliteTimeFormat)); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, sessionID, userID, r.UserAgent(), ip, now.Format(sqliteTimeFormat), now.Format(sqliteTimeFormat),
+		now.Add(refreshTokenDuration).Format(sqliteTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO refresh_tokens (session_id, token_hash) VALUES (?, ?)", sessionID, hashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &SessionRefresh{SessionID: sessionID, UserID: userID, RefreshToken: refreshToken}, nil
+}
+
+// refreshGracePeriod is how long a rotated refresh token still returns its successor, so two tabs
+// refreshing at the same moment both carry on instead of one of them revoking the session.
+const refreshGracePeriod = 10 * time.Second
+
+// RotateRefreshToken spends a refresh token and returns its successor, extending the session.
+// Presenting a token that was already spent revokes the session and every token of it, unless
+// it was spent within refreshGracePeriod, in which case it returns the same successor again.
+func (s *AuthService) RotateRefreshToken(ctx context.Context, refreshToken string) (*SessionRefresh, error) {
+	now := time.Now().UTC()
+
+	successor, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealSuccessor(refreshToken, successor)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// spending the token is the first write, so of two concurrent refreshes only one spends it
+	result, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ?, successor = ? WHERE token_hash = ? AND used_at IS NULL",
+		now.Format(sqliteTimeFormat), sealed, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		tx.Rollback()
+		return s.reuseRefreshToken(ctx, refreshToken, now)
+	}
+
+	var expired bool
+	refresh := &SessionRefresh{RefreshToken: successor}
+	err = tx.QueryRowContext(ctx, `
+		SELECT s.id, s.user_id, s.expires_at <= ?
+		FROM refresh_tokens t
+		JOIN sessions s ON s.id = t.session_id
+		WHERE t.token_hash = ?
+	`, now.Format(sqliteTimeFormat), hashToken(refreshToken)).Scan(&refresh.SessionID, &refresh.UserID, &expired)
+	if err != nil {
+		return nil, err
+	}
+
+	if expired {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", refresh.SessionID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO refresh_tokens (session_id, token_hash) VALUES (?, ?)", refresh.SessionID, hashToken(successor)); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?",
+		now.Format(sqliteTimeFormat), now.Add(refreshTokenDuration).Format(sqliteTimeFormat), refresh.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return refresh, tx.Commit()
+}
+
+// reuseRefreshToken answers a refresh token that is unknown or already spent. Within the grace
+// period it returns the successor issued for it, otherwise the session is revoked.
+func (s *AuthService) reuseRefreshToken(ctx context.Context, refreshToken string, now time.Time) (*SessionRefresh, error) {
+	var usedAt time.Time
+	var sealed string
+	var expired bool
+	refresh := &SessionRefresh{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.used_at, COALESCE(t.successor, ''), s.expires_at <= ?, s.id, s.user_id
+		FROM refresh_tokens t
+		JOIN sessions s ON s.id = t.session_id
+		WHERE t.token_hash = ? AND t.used_at IS NOT NULL
+	`, now.Format(sqliteTimeFormat), hashToken(refreshToken)).Scan(&usedAt, &sealed, &expired, &refresh.SessionID, &refresh.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !expired && sealed != "" && now.Sub(usedAt) <= refreshGracePeriod {
+		refresh.RefreshToken, err = openSuccessor(refreshToken, sealed)
+		if err == nil {
+			return refresh, nil
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", refresh.SessionID); err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrInvalidRefreshToken
+	}
+	return nil, ErrRefreshTokenReused
+}
+
+// sealSuccessor encrypts a refresh token's successor with a key only the token itself gives, so
+// the stored successor is of no use to anyone who can read the database but holds no token.
+func sealSuccessor(refreshToken, successor string) (string, error) {
+	gcm, err := successorCipher(refreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(successor), nil)), nil
+}
+
+func openSuccessor(refreshToken, sealed string) (string, error) {
+	gcm, err := successorCipher(refreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid sealed refresh token")
+	}
+	successor, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(successor), nil
+}
+
+// successorCipher derives its key apart from hashToken, as the token's hash is stored next to it.
+func successorCipher(refreshToken string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("refresh-successor:" + refreshToken))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to, for logging out once the access
+// token has expired.
+func (s *AuthService) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = (SELECT session_id FROM refresh_tokens WHERE token_hash = ?)", hashToken(refreshToken))
+	return err
+}
+
+// checkSession fails for a token whose session was revoked, and refreshes the claims from the
+// user's current name and admin flag.
+func (s *AuthService) checkSession(ctx context.Context, claims *Claims) error {
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.username, u.is_admin
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = ? AND s.user_id = ?
+	`, claims.ID, claims.UserID).Scan(&claims.Username, &claims.IsAdmin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+
+	// last seen is only tracked to the minute, so browsing doesn't write on every request
+	now := time.Now().UTC()
+	_, err = s.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ? AND last_seen_at < ?",
+		now.Format(sqliteTimeFormat), claims.ID, now.Add(-time.Minute).Format(sqliteTimeFormat))
+	return err
+}
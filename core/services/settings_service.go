@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"dsn/core/database"
+	"dsn/core/types"
+	"errors"
+	"strconv"
+)
+
+const settingTwoFactorRequired = "two_factor_required"
+
+type SettingsService struct {
+	db *sql.DB
+}
+
+func NewSettingsService() *SettingsService {
+	return &SettingsService{db: database.DB}
+}
+
+func (s *SettingsService) Get(ctx context.Context) (*types.Settings, error) {
+	required, err := twoFactorRequired(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.Settings{TwoFactorRequired: required}, nil
+}
+
+func (s *SettingsService) Update(ctx context.Context, settings types.Settings) (*types.Settings, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value
+	`, settingTwoFactorRequired, strconv.FormatBool(settings.TwoFactorRequired))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx)
+}
+
+// twoFactorRequired reports whether an admin has made two-factor authentication mandatory.
+func twoFactorRequired(ctx context.Context, db *sql.DB) (bool, error) {
+	var value string
+	err := db.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?", settingTwoFactorRequired).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(value)
+}
@@ -4,9 +4,34 @@ import (
 	"database/sql"
 	"dsn/core/database"
 	"dsn/core/types"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ncruces/go-sqlite3"
 )
 
+// ErrTagExists is returned when a user already has a tag with the name being given.
+var ErrTagExists = errors.New("tag already exists")
+
+// ErrTagCycle is returned when a tag would be moved under itself or one of its descendants.
+var ErrTagCycle = errors.New("tag can't be moved under its own subtree")
+
+// TagInUseError is returned when a tag to be deleted is named by rules, which have to be changed
+// or deleted first so no rule is lost along with the tag.
+type TagInUseError struct {
+	Rules []string
+}
+
+func (e *TagInUseError) Error() string {
+	return "tag is used by rules: " + strings.Join(e.Rules, ", ")
+}
+
+// ErrNotFound is returned for notes and tags that do not exist or belong to another user.
+var ErrNotFound = errors.New("not found")
+
 type TagService struct {
 	db *sql.DB
 }
@@ -15,10 +40,10 @@ func NewTagService() *TagService {
 	return &TagService{db: database.DB}
 }
 
-func (s *TagService) Create(req types.CreateTagRequest) (*types.Tag, error) {
+func (s *TagService) Create(userID int, req types.CreateTagRequest) (*types.Tag, error) {
 	query := `
-		INSERT INTO tags (name, color) 
-		VALUES (?, ?)
+		INSERT INTO tags (user_id, parent_id, name, color) 
+		VALUES (?, ?, ?, ?)
 		RETURNING id, created_at
 	`
 
@@ -27,53 +52,87 @@ func (s *TagService) Create(req types.CreateTagRequest) (*types.Tag, error) {
 		color = "#e0e0e0"
 	}
 
+	if req.ParentID != nil {
+		if _, err := s.GetByID(*req.ParentID, userID); err != nil {
+			return nil, err
+		}
+	}
+
 	var tag types.Tag
-	err := s.db.QueryRow(query, req.Name, color).Scan(&tag.ID, &tag.CreatedAt)
+	err := s.db.QueryRow(query, userID, req.ParentID, req.Name, color).Scan(&tag.ID, &tag.CreatedAt)
+	if errors.Is(err, sqlite3.CONSTRAINT_UNIQUE) {
+		return nil, ErrTagExists
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	tag.ParentID = req.ParentID
 	tag.Name = req.Name
 	tag.Color = color
 
 	return &tag, nil
 }
 
-func (s *TagService) GetAll() ([]types.Tag, error) {
+func (s *TagService) GetAll(userID int) ([]types.TagStats, error) {
 	query := `
-		SELECT id, name, color, created_at 
-		FROM tags 
-		ORDER BY name ASC
+		SELECT t.id, t.parent_id, t.name, t.color, t.created_at,
+			COUNT(n.id) - COALESCE(SUM(n.archived), 0),
+			COALESCE(SUM(n.archived), 0),
+			MAX(n.updated_at)
+		FROM tags t
+		LEFT JOIN note_tags nt ON nt.tag_id = t.id
+		LEFT JOIN notes n ON n.id = nt.note_id AND n.deleted_at IS NULL
+		WHERE t.user_id = ?
+		GROUP BY t.id
+		ORDER BY t.name ASC
 	`
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	tags := make([]types.Tag, 0)
+	tags := make([]types.TagStats, 0)
 	for rows.Next() {
-		var tag types.Tag
-		err := rows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt)
+		var tag types.TagStats
+		// an aggregate has no declared type, so the driver hands MAX(updated_at) back as text
+		var lastUsed sql.NullString
+		err := rows.Scan(&tag.ID, &tag.ParentID, &tag.Name, &tag.Color, &tag.CreatedAt,
+			&tag.ActiveNotes, &tag.ArchivedNotes, &lastUsed)
 		if err != nil {
 			return nil, err
 		}
+		if lastUsed.Valid {
+			lastUsedAt, err := time.Parse(sqliteTimeFormat, lastUsed.String)
+			if err != nil {
+				return nil, err
+			}
+			tag.LastUsedAt = &lastUsedAt
+		}
 		tags = append(tags, tag)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return tags, nil
 }
 
-func (s *TagService) GetByID(id int) (*types.Tag, error) {
+func (s *TagService) GetByID(id, userID int) (*types.Tag, error) {
 	query := `
-		SELECT id, name, color, created_at 
+		SELECT id, parent_id, name, color, created_at 
 		FROM tags 
-		WHERE id = ?
+		WHERE id = ? AND user_id = ?
 	`
 
 	var tag types.Tag
-	err := s.db.QueryRow(query, id).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt)
+	err := s.db.QueryRow(query, id, userID).Scan(&tag.ID, &tag.ParentID, &tag.Name, &tag.Color, &tag.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("tag with id %d: %w", id, ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +140,7 @@ func (s *TagService) GetByID(id int) (*types.Tag, error) {
 	return &tag, nil
 }
 
-func (s *TagService) Update(id int, req types.UpdateTagRequest) (*types.Tag, error) {
+func (s *TagService) Update(id, userID int, req types.UpdateTagRequest) (*types.Tag, error) {
 	var setParts []string
 	var args []interface{}
 
@@ -95,22 +154,21 @@ func (s *TagService) Update(id int, req types.UpdateTagRequest) (*types.Tag, err
 	}
 
 	if len(setParts) == 0 {
-		return s.GetByID(id)
+		return s.GetByID(id, userID)
 	}
 
-	args = append(args, id)
+	args = append(args, id, userID)
 
 	query := fmt.Sprintf(`
 		UPDATE tags 
 		SET %s 
-		WHERE id = ?
-	`, fmt.Sprintf("%s", setParts[0]))
-
-	for i := 1; i < len(setParts); i++ {
-		query = fmt.Sprintf("%s, %s", query, setParts[i])
-	}
+		WHERE id = ? AND user_id = ?
+	`, strings.Join(setParts, ", "))
 
 	result, err := s.db.Exec(query, args...)
+	if errors.Is(err, sqlite3.CONSTRAINT_UNIQUE) {
+		return nil, ErrTagExists
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -121,15 +179,40 @@ func (s *TagService) Update(id int, req types.UpdateTagRequest) (*types.Tag, err
 	}
 
 	if rowsAffected == 0 {
-		return nil, fmt.Errorf("tag with id %d not found", id)
+		return nil, fmt.Errorf("tag with id %d: %w", id, ErrNotFound)
 	}
 
-	return s.GetByID(id)
+	return s.GetByID(id, userID)
 }
 
-func (s *TagService) Delete(id int) error {
-	query := "DELETE FROM tags WHERE id = ?"
-	result, err := s.db.Exec(query, id)
+// Delete removes a tag, its children move up to the deleted tag's parent. A tag named by a rule
+// is kept and a *TagInUseError returned.
+func (s *TagService) Delete(id, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rules, err := tagRules(tx, id, userID)
+	if err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		return &TagInUseError{Rules: rules}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tags 
+		SET parent_id = (SELECT parent_id FROM tags WHERE id = ? AND user_id = ?) 
+		WHERE parent_id = ? AND user_id = ?
+	`, id, userID, id, userID)
+	if err != nil {
+		return err
+	}
+
+	query := "DELETE FROM tags WHERE id = ? AND user_id = ?"
+	result, err := tx.Exec(query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -140,24 +223,135 @@ func (s *TagService) Delete(id int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("tag with id %d not found", id)
+		return fmt.Errorf("tag with id %d: %w", id, ErrNotFound)
 	}
 
-	return nil
+	return tx.Commit()
+}
+
+// tagRules returns the names of the user's rules that match on or add a tag.
+func tagRules(tx *sql.Tx, tagID, userID int) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT id, name FROM note_rules
+		WHERE user_id = ? AND ? IN (match_tag_id, add_tag_id)
+		ORDER BY id
+	`, userID, tagID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = fmt.Sprintf("#%d", id)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// GetTree returns a user's tags nested under their parents, each level sorted by name.
+func (s *TagService) GetTree(userID int) ([]types.TagNode, error) {
+	tags, err := s.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]types.TagStats)
+	var roots []types.TagStats
+	for _, tag := range tags {
+		if tag.ParentID == nil {
+			roots = append(roots, tag)
+		} else {
+			children[*tag.ParentID] = append(children[*tag.ParentID], tag)
+		}
+	}
+
+	var build func(tags []types.TagStats) []types.TagNode
+	build = func(tags []types.TagStats) []types.TagNode {
+		nodes := make([]types.TagNode, 0, len(tags))
+		for _, tag := range tags {
+			nodes = append(nodes, types.TagNode{TagStats: tag, Children: build(children[tag.ID])})
+		}
+		return nodes
+	}
+
+	return build(roots), nil
+}
+
+// Move puts a tag and its subtree under parentID, or at the top level when parentID is nil.
+// A tag can't be moved under itself or one of its descendants, see ErrTagCycle.
+func (s *TagService) Move(id, userID int, parentID *int) (*types.Tag, error) {
+	if _, err := s.GetByID(id, userID); err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		if _, err := s.GetByID(*parentID, userID); err != nil {
+			return nil, err
+		}
+
+		var cycle bool
+		query := "SELECT ? IN (" + tagSubtreeQuery("SELECT ?") + ")"
+		err := s.db.QueryRow(query, *parentID, id).Scan(&cycle)
+		if err != nil {
+			return nil, err
+		}
+		if cycle {
+			return nil, ErrTagCycle
+		}
+	}
+
+	_, err := s.db.Exec("UPDATE tags SET parent_id = ? WHERE id = ? AND user_id = ?", parentID, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(id, userID)
 }
 
-func (s *TagService) AssignToNote(noteID, tagID int) error {
+func (s *TagService) AssignToNote(noteID, tagID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNoteTagsAccess(tx, noteID, userID, []int{tagID}); err != nil {
+		return err
+	}
+
 	query := `
 		INSERT OR IGNORE INTO note_tags (note_id, tag_id) 
 		VALUES (?, ?)
 	`
-	_, err := s.db.Exec(query, noteID, tagID)
-	return err
+	if _, err := tx.Exec(query, noteID, tagID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (s *TagService) RemoveFromNote(noteID, tagID int) error {
+func (s *TagService) RemoveFromNote(noteID, tagID, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNoteTagsAccess(tx, noteID, userID, []int{tagID}); err != nil {
+		return err
+	}
+
 	query := "DELETE FROM note_tags WHERE note_id = ? AND tag_id = ?"
-	result, err := s.db.Exec(query, noteID, tagID)
+	result, err := tx.Exec(query, noteID, tagID)
 	if err != nil {
 		return err
 	}
@@ -168,26 +362,30 @@ func (s *TagService) RemoveFromNote(noteID, tagID int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("tag %d not assigned to note %d", tagID, noteID)
+		return fmt.Errorf("tag %d not assigned to note %d: %w", tagID, noteID, ErrNotFound)
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (s *TagService) SetNoteTags(noteID int, tagIDs []int) error {
+func (s *TagService) SetNoteTags(noteID, userID int, tagIDs []int) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	if err := checkNoteTagsAccess(tx, noteID, userID, tagIDs); err != nil {
+		return err
+	}
+
 	_, err = tx.Exec("DELETE FROM note_tags WHERE note_id = ?", noteID)
 	if err != nil {
 		return err
 	}
 
 	for _, tagID := range tagIDs {
-		_, err = tx.Exec("INSERT INTO note_tags (note_id, tag_id) VALUES (?, ?)", noteID, tagID)
+		_, err = tx.Exec("INSERT OR IGNORE INTO note_tags (note_id, tag_id) VALUES (?, ?)", noteID, tagID)
 		if err != nil {
 			return err
 		}
@@ -195,3 +393,267 @@ func (s *TagService) SetNoteTags(noteID int, tagIDs []int) error {
 
 	return tx.Commit()
 }
+
+// unusedTagsQuery selects a user's tags that are on no note, trashed ones included, are named
+// by none of their rules, and have no descendant that is. Its set is closed under descendants,
+// so deleting it orphans nothing, and a rule is never deleted along with its tag.
+const unusedTagsQuery = `
+	WITH RECURSIVE used(id) AS (
+		SELECT DISTINCT nt.tag_id
+		FROM note_tags nt
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE t.user_id = ?
+		UNION
+		SELECT t.id
+		FROM note_rules r
+		JOIN tags t ON t.id IN (r.match_tag_id, r.add_tag_id)
+		WHERE r.user_id = ?
+		UNION
+		SELECT t.parent_id FROM tags t JOIN used ON t.id = used.id WHERE t.parent_id IS NOT NULL
+	)
+	SELECT id FROM tags WHERE user_id = ? AND id NOT IN (SELECT id FROM used)
+`
+
+func (s *TagService) GetUnused(userID int) ([]types.Tag, error) {
+	query := `
+		SELECT id, parent_id, name, color, created_at
+		FROM tags
+		WHERE id IN (` + unusedTagsQuery + `)
+		ORDER BY name ASC
+	`
+
+	rows, err := s.db.Query(query, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTags(rows)
+}
+
+// DeleteUnused deletes every tag GetUnused would return and returns the deleted tags.
+func (s *TagService) DeleteUnused(userID int) ([]types.Tag, error) {
+	query := `
+		DELETE FROM tags
+		WHERE id IN (` + unusedTagsQuery + `)
+		RETURNING id, parent_id, name, color, created_at
+	`
+
+	rows, err := s.db.Query(query, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTags(rows)
+}
+
+func scanTags(rows *sql.Rows) ([]types.Tag, error) {
+	tags := make([]types.Tag, 0)
+	for rows.Next() {
+		var tag types.Tag
+		if err := rows.Scan(&tag.ID, &tag.ParentID, &tag.Name, &tag.Color, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Merge folds the source tags into the target: their notes get the target tag and the sources are
+// deleted, with their children moving up as for Delete. It all happens in one transaction.
+func (s *TagService) Merge(targetID, userID int, sourceIDs []int) (*types.Tag, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sources := make([]int, 0, len(sourceIDs))
+	for _, id := range sourceIDs {
+		if id != targetID && !slices.Contains(sources, id) {
+			sources = append(sources, id)
+		}
+	}
+	if err := checkTagsOwned(tx, userID, append(sources, targetID)); err != nil {
+		return nil, err
+	}
+
+	for _, sourceID := range sources {
+		// OR IGNORE skips notes that already have the target, so no pair is duplicated
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO note_tags (note_id, tag_id)
+			SELECT note_id, ? FROM note_tags WHERE tag_id = ?
+		`, targetID, sourceID)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE tags 
+			SET parent_id = (SELECT parent_id FROM tags WHERE id = ?) 
+			WHERE parent_id = ?
+		`, sourceID, sourceID)
+		if err != nil {
+			return nil, err
+		}
+
+		// rules would otherwise be deleted along with the source
+		for _, column := range []string{"match_tag_id", "add_tag_id"} {
+			_, err := tx.Exec("UPDATE note_rules SET "+column+" = ? WHERE "+column+" = ?", targetID, sourceID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", sourceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(targetID, userID)
+}
+
+const (
+	BulkTagAdd    = "add"
+	BulkTagRemove = "remove"
+)
+
+// BulkUpdate adds a tag to or removes it from many notes, chosen either by id or by a query
+// in the search grammar of parseSearchQuery. It returns the number of notes that changed.
+func (s *TagService) BulkUpdate(tagID, userID int, req types.BulkTagRequest) (int, error) {
+	where := []string{"notes.user_id = ?", "notes.deleted_at IS NULL"}
+	args := []any{userID}
+
+	if req.Query != "" {
+		condition, err := parseSearchQuery(req.Query)
+		if err != nil {
+			return 0, err
+		}
+		where = append(where, condition.sql)
+		args = append(args, condition.args...)
+	} else {
+		if len(req.NoteIDs) == 0 {
+			return 0, nil
+		}
+		where = append(where, "notes.id IN (?"+strings.Repeat(", ?", len(req.NoteIDs)-1)+")")
+		for _, id := range req.NoteIDs {
+			args = append(args, id)
+		}
+	}
+	notesQuery := "SELECT notes.id FROM notes WHERE " + strings.Join(where, " AND ")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkTagsOwned(tx, userID, []int{tagID}); err != nil {
+		return 0, err
+	}
+
+	if req.Query == "" {
+		// notes of other users are reported as missing rather than silently skipped
+		var found int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM ("+notesQuery+")", args...).Scan(&found); err != nil {
+			return 0, err
+		}
+		if found != len(uniqueIDs(req.NoteIDs)) {
+			return 0, fmt.Errorf("notes %v: %w", req.NoteIDs, ErrNotFound)
+		}
+	}
+
+	var result sql.Result
+	switch req.Action {
+	case BulkTagAdd:
+		result, err = tx.Exec("INSERT OR IGNORE INTO note_tags (note_id, tag_id) SELECT id, ? FROM ("+notesQuery+")",
+			append([]any{tagID}, args...)...)
+	case BulkTagRemove:
+		result, err = tx.Exec("DELETE FROM note_tags WHERE tag_id = ? AND note_id IN ("+notesQuery+")",
+			append([]any{tagID}, args...)...)
+	default:
+		return 0, fmt.Errorf("unknown bulk action %q", req.Action)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(updated), tx.Commit()
+}
+
+// tagSubtreeQuery selects the ids of the tags chosen by rootQuery and of all their descendants.
+func tagSubtreeQuery(rootQuery string) string {
+	return `
+		WITH RECURSIVE subtree(id) AS (
+			` + rootQuery + `
+			UNION
+			SELECT t.id FROM tags t JOIN subtree ON t.parent_id = subtree.id
+		)
+		SELECT id FROM subtree`
+}
+
+// checkNoteTagsAccess makes sure a note and tags all belong to userID. Notes and tags of other
+// users are reported as ErrNotFound, the same as ones that do not exist, so ids can't be probed.
+func checkNoteTagsAccess(tx *sql.Tx, noteID, userID int, tagIDs []int) error {
+	var noteExists bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM notes WHERE id = ? AND user_id = ? AND deleted_at IS NULL)
+	`, noteID, userID).Scan(&noteExists)
+	if err != nil {
+		return err
+	}
+	if !noteExists {
+		return fmt.Errorf("note with id %d: %w", noteID, ErrNotFound)
+	}
+
+	return checkTagsOwned(tx, userID, tagIDs)
+}
+
+// checkTagsOwned reports ErrNotFound unless every tag belongs to userID.
+func checkTagsOwned(tx *sql.Tx, userID int, tagIDs []int) error {
+	unique := uniqueIDs(tagIDs)
+	if len(unique) == 0 {
+		return nil
+	}
+
+	args := []any{userID}
+	for _, id := range unique {
+		args = append(args, id)
+	}
+
+	var owned int
+	query := "SELECT COUNT(*) FROM tags WHERE user_id = ? AND id IN (?" + strings.Repeat(", ?", len(unique)-1) + ")"
+	if err := tx.QueryRow(query, args...).Scan(&owned); err != nil {
+		return err
+	}
+	if owned != len(unique) {
+		return fmt.Errorf("tags %v: %w", tagIDs, ErrNotFound)
+	}
+
+	return nil
+}
+
+func uniqueIDs(ids []int) []int {
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !slices.Contains(unique, id) {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
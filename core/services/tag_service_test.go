@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"dsn/core/types"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDeleteTagUsedByRule(t *testing.T) {
+	ctx := context.Background()
+	tags := NewTagService()
+	rules := NewNoteRuleService()
+	user := createTestUser(t, "tag-in-rule")
+
+	matched, err := tags.Create(user.ID, types.CreateTagRequest{Name: "matched"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := tags.Create(user.ID, types.CreateTagRequest{Name: "added"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := rules.Create(ctx, user.ID, types.NoteRuleRequest{
+		Name:    "file matched notes",
+		Match:   types.NoteRuleMatch{TagID: &matched.ID},
+		Actions: types.NoteRuleActions{AddTagID: &added.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []*types.Tag{matched, added} {
+		var inUse *TagInUseError
+		if err := tags.Delete(tag.ID, user.ID); !errors.As(err, &inUse) || !slices.Equal(inUse.Rules, []string{rule.Name}) {
+			t.Errorf("deleting tag %q: got %v, want a TagInUseError naming the rule", tag.Name, err)
+		}
+	}
+	if _, err := rules.GetByID(ctx, rule.ID, user.ID); err != nil {
+		t.Fatalf("rule lost with its tag: %v", err)
+	}
+
+	if err := rules.Delete(ctx, rule.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Delete(matched.ID, user.ID); err != nil {
+		t.Errorf("deleting a tag no rule uses: %v", err)
+	}
+}
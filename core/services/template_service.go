@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"dsn/core/database"
+	"dsn/core/logic"
+	"dsn/core/types"
+	"encoding/json"
+	"fmt"
+	"html"
+	"time"
+)
+
+const templateColumns = "id, name, title, content, color, kind, items, created_at, updated_at"
+
+type TemplateService struct {
+	db *sql.DB
+}
+
+func NewTemplateService() *TemplateService {
+	return &TemplateService{db: database.DB}
+}
+
+func (s *TemplateService) Create(ctx context.Context, userID int, req types.NoteTemplateRequest) (*types.NoteTemplate, error) {
+	req, items, err := prepareTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO note_templates (user_id, name, title, content, color, kind, items)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, req.Name, req.Title, req.Content, req.Color, req.Kind, items).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, id, userID)
+}
+
+func (s *TemplateService) GetAll(ctx context.Context, userID int) ([]types.NoteTemplate, error) {
+	return queryTemplates(ctx, s.db, "SELECT "+templateColumns+" FROM note_templates WHERE user_id = ? ORDER BY name COLLATE NOCASE", userID)
+}
+
+func (s *TemplateService) GetByID(ctx context.Context, id, userID int) (*types.NoteTemplate, error) {
+	return getTemplate(ctx, s.db, id, userID)
+}
+
+func (s *TemplateService) Update(ctx context.Context, id, userID int, req types.NoteTemplateRequest) (*types.NoteTemplate, error) {
+	req, items, err := prepareTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE note_templates
+		SET name = ?, title = ?, content = ?, color = ?, kind = ?, items = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ?
+	`, req.Name, req.Title, req.Content, req.Color, req.Kind, items, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("template with id %d: %w", id, ErrNotFound)
+	}
+
+	return s.GetByID(ctx, id, userID)
+}
+
+func (s *TemplateService) Delete(ctx context.Context, id, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM note_templates WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("template with id %d: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// prepareTemplate sanitizes a template's content and encodes its items for storage.
+func prepareTemplate(req types.NoteTemplateRequest) (types.NoteTemplateRequest, string, error) {
+	if req.Kind == "" {
+		req.Kind = types.NoteKindText
+	}
+	if !IsValidNoteKind(req.Kind) {
+		return req, "", fmt.Errorf("unknown note kind %q", req.Kind)
+	}
+	if len(req.Items) > 0 && req.Kind != types.NoteKindChecklist {
+		return req, "", ErrNotChecklist
+	}
+	if req.Items == nil {
+		req.Items = []types.NoteTemplateItem{}
+	}
+
+	req.Content = logic.SanitizeHTML(req.Content)
+
+	items, err := json.Marshal(req.Items)
+	return req, string(items), err
+}
+
+func getTemplate(ctx context.Context, db queryer, id, userID int) (*types.NoteTemplate, error) {
+	templates, err := queryTemplates(ctx, db, "SELECT "+templateColumns+" FROM note_templates WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("template with id %d: %w", id, ErrNotFound)
+	}
+
+	return &templates[0], nil
+}
+
+func queryTemplates(ctx context.Context, db queryer, query string, args ...any) ([]types.NoteTemplate, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]types.NoteTemplate, 0)
+	for rows.Next() {
+		var template types.NoteTemplate
+		var items string
+		err := rows.Scan(&template.ID, &template.Name, &template.Title, &template.Content, &template.Color,
+			&template.Kind, &items, &template.CreatedAt, &template.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(items), &template.Items); err != nil {
+			return nil, fmt.Errorf("items of template %d: %w", template.ID, err)
+		}
+		templates = append(templates, template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// applyTemplate fills the fields req leaves empty from its template and expands the placeholders
+// of the result as of now. A template the user does not own returns ErrNotFound.
+func (s *NoteService) applyTemplate(ctx context.Context, userID int, req *types.CreateNoteRequest, now time.Time) error {
+	template, err := getTemplate(ctx, s.db, req.TemplateID, userID)
+	if err != nil {
+		return err
+	}
+
+	if req.Title == "" {
+		req.Title = template.Title
+	}
+	if req.Content == "" {
+		req.Content = template.Content
+	}
+	if req.Color == "" {
+		req.Color = template.Color
+	}
+	if req.Kind == "" {
+		req.Kind = template.Kind
+	}
+	if len(req.Items) == 0 && req.Kind == template.Kind {
+		for _, item := range template.Items {
+			req.Items = append(req.Items, types.CreateNoteItemRequest{Text: item.Text, Checked: item.Checked})
+		}
+	}
+
+	var username string
+	if err := s.db.QueryRowContext(ctx, "SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		return err
+	}
+
+	values := logic.PlaceholderValues(now, username)
+	htmlValues := make(map[string]string, len(values))
+	for name, value := range values {
+		htmlValues[name] = html.EscapeString(value)
+	}
+
+	req.Title = logic.ExpandPlaceholders(req.Title, values)
+	req.Content = logic.ExpandPlaceholders(req.Content, htmlValues)
+	for i := range req.Items {
+		req.Items[i].Text = logic.ExpandPlaceholders(req.Items[i].Text, values)
+	}
+
+	return nil
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"dsn/core/database"
+	"dsn/core/logic"
+	"dsn/core/types"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCode = errors.New("invalid two-factor code")
+
+var ErrInvalidPendingLogin = errors.New("pending login is invalid or has expired")
+
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+var ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+
+var ErrTwoFactorNotEnrolled = errors.New("two-factor enrollment has not been started")
+
+var ErrTwoFactorRequired = errors.New("two-factor authentication is required")
+
+const (
+	// totpIssuer names the server in authenticator apps
+	totpIssuer = "DSN"
+
+	recoveryCodeCount = 10
+
+	pendingLoginTTL = 5 * time.Minute
+
+	// a pending login is dropped after this many wrong codes, so codes can't be guessed
+	maxPendingLoginAttempts = 5
+)
+
+type TwoFactorService struct {
+	db *sql.DB
+}
+
+func NewTwoFactorService() *TwoFactorService {
+	return &TwoFactorService{db: database.DB}
+}
+
+type twoFactorState struct {
+	username string
+	secret   string
+	enabled  bool
+	lastStep int64
+}
+
+func (s *TwoFactorService) Status(ctx context.Context, userID int) (*types.TwoFactorStatus, error) {
+	state, err := s.state(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := twoFactorRequired(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &types.TwoFactorStatus{Enabled: state.enabled, Required: required}
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&status.RecoveryCodesLeft)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// NeedsTwoFactor reports whether a login of the user has to pass a second factor, because they
+// enabled it or an admin requires it.
+func (s *TwoFactorService) NeedsTwoFactor(ctx context.Context, userID int) (bool, error) {
+	state, err := s.state(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if state.enabled {
+		return true, nil
+	}
+
+	return twoFactorRequired(ctx, s.db)
+}
+
+// Enroll gives the user a new TOTP secret, which takes effect once Confirm is called with a
+// code from it. Enrolling again before confirming replaces the secret.
+func (s *TwoFactorService) Enroll(ctx context.Context, userID int) (*types.TwoFactorEnrollment, error) {
+	state, err := s.state(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := logic.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE users SET totp_secret = ? WHERE id = ?", secret, userID); err != nil {
+		return nil, err
+	}
+
+	return &types.TwoFactorEnrollment{Secret: secret, URI: logic.TOTPURI(totpIssuer, state.username, secret)}, nil
+}
+
+// Confirm enables two-factor authentication with a code from the enrolled secret and returns
+// the user's recovery codes.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int, code string, now time.Time) ([]string, error) {
+	state, err := s.state(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if state.secret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := logic.ValidateTOTP(state.secret, code, now)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := newRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// Disable turns two-factor authentication off after checking a code, unless an admin requires it.
+func (s *TwoFactorService) Disable(ctx context.Context, userID int, code string, now time.Time) error {
+	required, err := twoFactorRequired(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+
+	if err := s.verify(ctx, userID, code, now); err != nil {
+		return err
+	}
+
+	return s.Reset(ctx, userID)
+}
+
+// Reset turns two-factor authentication off without a code, for an admin helping a user who lost
+// their authenticator and recovery codes.
+func (s *TwoFactorService) Reset(ctx context.Context, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE users SET totp_secret = '', totp_enabled = FALSE, totp_last_step = 0 WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d: %w", userID, ErrNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string, now time.Time) ([]string, error) {
+	if err := s.verify(ctx, userID, code, now); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := newRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// StartLogin records a login that has passed its password and returns the token that completes it.
+func (s *TwoFactorService) StartLogin(ctx context.Context, userID int, now time.Time) (*types.TwoFactorChallenge, error) {
+	state, err := s.state(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	expiresAt := now.Add(pendingLoginTTL)
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM pending_logins WHERE expires_at <= ?", now.Format(sqliteTimeFormat)); err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, "INSERT INTO pending_logins (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, hashToken(token), expiresAt.Format(sqliteTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.TwoFactorChallenge{PendingToken: token, EnrollmentRequired: !state.enabled, ExpiresAt: expiresAt.Truncate(time.Second)}, nil
+}
+
+// EnrollPendingLogin enrolls the user of a pending login, for a user who has to set up two-factor
+// authentication before they can log in.
+func (s *TwoFactorService) EnrollPendingLogin(ctx context.Context, pendingToken string, now time.Time) (*types.TwoFactorEnrollment, error) {
+	var userID int
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM pending_logins WHERE token_hash = ? AND expires_at > ?",
+		hashToken(pendingToken), now.UTC().Format(sqliteTimeFormat)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidPendingLogin
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Enroll(ctx, userID)
+}
+
+// CompleteLogin checks the second factor of a pending login and returns its user. A user who was
+// enrolling is enabled by the code, and their new recovery codes are returned as well.
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, pendingToken, code string, now time.Time) (int, []string, error) {
+	tokenHash := hashToken(pendingToken)
+
+	var userID int
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE pending_logins SET attempts = attempts + 1
+		WHERE token_hash = ? AND expires_at > ? AND attempts < ?
+		RETURNING user_id
+	`, tokenHash, now.UTC().Format(sqliteTimeFormat), maxPendingLoginAttempts).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, ErrInvalidPendingLogin
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	state, err := s.state(ctx, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var codes []string
+	if state.enabled {
+		err = s.verify(ctx, userID, code, now)
+	} else {
+		codes, err = s.Confirm(ctx, userID, code, now)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM pending_logins WHERE token_hash = ?", tokenHash); err != nil {
+		return 0, nil, err
+	}
+
+	return userID, codes, nil
+}
+
+// verify accepts a TOTP code newer than the last one used, or an unused recovery code, which is
+// then spent.
+func (s *TwoFactorService) verify(ctx context.Context, userID int, code string, now time.Time) error {
+	state, err := s.state(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !state.enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := logic.ValidateTOTP(state.secret, code, now); ok {
+		// the step only moves forward, so a code can't be replayed within its window
+		result, err := s.db.ExecContext(ctx, "UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, userID, step)
+		if err != nil {
+			return err
+		}
+		return spendCode(result)
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userID, hashToken(normaliseRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	return spendCode(result)
+}
+
+func (s *TwoFactorService) state(ctx context.Context, userID int) (*twoFactorState, error) {
+	var state twoFactorState
+	err := s.db.QueryRowContext(ctx, "SELECT username, totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?", userID).
+		Scan(&state.username, &state.secret, &state.enabled, &state.lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user with id %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// newRecoveryCodes replaces the user's recovery codes with new ones, formatted like xxxx-xxxx-xxxx-xxxx.
+func newRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(random))
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hashToken(code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+	}
+
+	return codes, nil
+}
+
+// normaliseRecoveryCode lets a recovery code be typed without its dashes or in capitals.
+func normaliseRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// spendCode checks that the update marking a code as used found it unused.
+func spendCode(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"dsn/core/logic"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorCodeReplay(t *testing.T) {
+	ctx := context.Background()
+	service := NewTwoFactorService()
+	user := createTestUser(t, "totp-replay")
+
+	enrollment, err := service.Enroll(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	codeAt := func(at time.Time) string {
+		code, err := logic.TOTPCode(enrollment.Secret, logic.TOTPStep(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	if _, err := service.Confirm(ctx, user.ID, codeAt(now), now); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+
+	// the step Confirm spent, and any earlier step still inside the skew window, are refused
+	for _, code := range []string{codeAt(now), codeAt(now.Add(-logic.TOTPPeriod * time.Second))} {
+		if _, err := service.RegenerateRecoveryCodes(ctx, user.ID, code, now); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("replayed code %s: got %v, want ErrInvalidCode", code, err)
+		}
+	}
+
+	next := now.Add(logic.TOTPPeriod * time.Second)
+	if _, err := service.RegenerateRecoveryCodes(ctx, user.ID, codeAt(next), next); err != nil {
+		t.Fatalf("code of the next step: %v", err)
+	}
+	if _, err := service.RegenerateRecoveryCodes(ctx, user.ID, codeAt(next), next); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("code of the next step used twice: got %v, want ErrInvalidCode", err)
+	}
+}
@@ -50,14 +50,14 @@ func (s *UserService) Create(req types.CreateUserRequest) (*types.User, error) {
 }
 
 func (s *UserService) GetByUsername(username string) (*types.User, error) {
-	query := `SELECT id, username, email, password_hash, is_admin, created_at, updated_at 
+	query := `SELECT id, username, email, password_hash, is_admin, totp_enabled, created_at, updated_at 
 		FROM users 
 		WHERE username = ?`
 
 	var user types.User
 	err := s.db.QueryRow(query, username).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
+		&user.IsAdmin, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -68,7 +68,7 @@ func (s *UserService) GetByUsername(username string) (*types.User, error) {
 
 func (s *UserService) GetByID(id int) (*types.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, is_admin, created_at, updated_at 
+		SELECT id, username, email, password_hash, is_admin, totp_enabled, created_at, updated_at 
 		FROM users 
 		WHERE id = ?
 	`
@@ -76,7 +76,7 @@ func (s *UserService) GetByID(id int) (*types.User, error) {
 	var user types.User
 	err := s.db.QueryRow(query, id).Scan(
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
+		&user.IsAdmin, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -87,7 +87,7 @@ func (s *UserService) GetByID(id int) (*types.User, error) {
 
 func (s *UserService) GetAll() ([]types.User, error) {
 	query := `
-		SELECT id, username, email, is_admin, created_at, updated_at 
+		SELECT id, username, email, is_admin, totp_enabled, created_at, updated_at 
 		FROM users 
 		ORDER BY created_at DESC
 	`
@@ -103,7 +103,7 @@ func (s *UserService) GetAll() ([]types.User, error) {
 		var user types.User
 		err := rows.Scan(
 			&user.ID, &user.Username, &user.Email,
-			&user.IsAdmin, &user.CreatedAt, &user.UpdatedAt,
+			&user.IsAdmin, &user.TwoFactorEnabled, &user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -5,36 +5,224 @@ import (
 )
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	IsAdmin      bool      `json:"is_admin"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID               int       `json:"id"`
+	Username         string    `json:"username"`
+	Email            string    `json:"email"`
+	PasswordHash     string    `json:"-"`
+	IsAdmin          bool      `json:"is_admin"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 type Note struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Color      string     `json:"color"`
+	Pinned     bool       `json:"pinned"`
+	Archived   bool       `json:"archived"`
+	Order      int        `json:"order"`
+	Version    int        `json:"version"`
+	Kind       string     `json:"kind"`
+	RemindAt   *time.Time `json:"remind_at,omitempty"`
+	Recurrence string     `json:"recurrence,omitempty"`
+	TimeZone   string     `json:"time_zone,omitempty"`
+	Tags       []Tag      `json:"tags,omitempty"`
+	Items      []NoteItem `json:"items,omitempty"`
+	Progress   *Progress  `json:"progress,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+const (
+	NoteKindText      = "text"
+	NoteKindChecklist = "checklist"
+)
+
+type NoteItem struct {
 	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
+	NoteID    int       `json:"note_id"`
+	Text      string    `json:"text"`
+	Checked   bool      `json:"checked"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Progress counts the checked items of a checklist note.
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+type NoteListOptions struct {
+	IncludeArchived bool
+	ArchivedOnly    bool
+	IncludeTrashed  bool
+	Pinned          *bool
+	Color           string
+	TagIDs          []int
+	TagsMode        string
+	ExcludeTagIDs   []int
+	Query           string
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	UpdatedAfter    *time.Time
+	UpdatedBefore   *time.Time
+	Sort            string
+	Direction       string
+	Cursor          string
+	Limit           int
+}
+
+type NotePage struct {
+	Notes      []Note `json:"notes"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// CollectionFilters are the listing filters of a saved search. The within-days filters are
+// relative to when the collection is read, so "this week" stays this week.
+type CollectionFilters struct {
+	Archived          string `json:"archived,omitempty"`
+	Pinned            *bool  `json:"pinned,omitempty"`
+	Color             string `json:"color,omitempty"`
+	Tags              []int  `json:"tags,omitempty"`
+	TagsMode          string `json:"tags_mode,omitempty"`
+	ExcludeTags       []int  `json:"exclude_tags,omitempty"`
+	CreatedWithinDays int    `json:"created_within_days,omitempty"`
+	UpdatedWithinDays int    `json:"updated_within_days,omitempty"`
+}
+
+// Collection is a saved search. Unread is only set when asked for and counts the matching
+// notes changed since the collection was last opened.
+type Collection struct {
+	ID           int               `json:"id"`
+	Name         string            `json:"name"`
+	Query        string            `json:"query"`
+	Filters      CollectionFilters `json:"filters"`
+	Sort         string            `json:"sort,omitempty"`
+	Direction    string            `json:"dir,omitempty"`
+	LastOpenedAt *time.Time        `json:"last_opened_at"`
+	Unread       *int              `json:"unread,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+type CollectionRequest struct {
+	Name      string            `json:"name"`
+	Query     string            `json:"query"`
+	Filters   CollectionFilters `json:"filters"`
+	Sort      string            `json:"sort,omitempty"`
+	Direction string            `json:"dir,omitempty"`
+}
+
+type Sidebar struct {
+	Tags        []TagNode    `json:"tags"`
+	Collections []Collection `json:"collections"`
+}
+
+type NoteSearchResult struct {
+	Note
+	Snippet        string `json:"snippet"`
+	TitleHighlight string `json:"title_highlight"`
+}
+
+type NoteRevision struct {
+	ID        int       `json:"id"`
+	NoteID    int       `json:"note_id"`
+	Revision  int       `json:"revision"`
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
-	Color     string    `json:"color"`
-	Pinned    bool      `json:"pinned"`
-	Archived  bool      `json:"archived"`
-	Order     int       `json:"order"`
-	Tags      []Tag     `json:"tags,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type NoteRevisionDiff struct {
+	NoteID int    `json:"note_id"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Diff   string `json:"diff"`
+}
+
+// DueReminder is a reminder that has fired and waits to be dismissed.
+type DueReminder struct {
+	ID      int       `json:"id"`
+	NoteID  int       `json:"note_id"`
+	Title   string    `json:"title"`
+	DueAt   time.Time `json:"due_at"`
+	FiredAt time.Time `json:"fired_at"`
 }
 
 type Tag struct {
 	ID        int       `json:"id"`
+	ParentID  *int      `json:"parent_id"`
 	Name      string    `json:"name"`
 	Color     string    `json:"color"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// TagStats is a tag with how many notes outside the trash use it and when one of them last changed.
+type TagStats struct {
+	Tag
+	ActiveNotes   int        `json:"active_notes"`
+	ArchivedNotes int        `json:"archived_notes"`
+	LastUsedAt    *time.Time `json:"last_used_at"`
+}
+
+type TagNode struct {
+	TagStats
+	Children []TagNode `json:"children"`
+}
+
+const (
+	RuleFieldAny     = "any"
+	RuleFieldTitle   = "title"
+	RuleFieldContent = "content"
+
+	RuleMatchSubstring = "substring"
+	RuleMatchRegex     = "regex"
+)
+
+// NoteRule acts on the notes that meet every condition of its Match that is set.
+type NoteRule struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Enabled   bool            `json:"enabled"`
+	Match     NoteRuleMatch   `json:"match"`
+	Actions   NoteRuleActions `json:"actions"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type NoteRuleMatch struct {
+	Field   string `json:"field"`
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+	TagID   *int   `json:"tag_id,omitempty"`
+	Color   string `json:"color,omitempty"`
+}
+
+type NoteRuleActions struct {
+	AddTagID *int   `json:"add_tag_id,omitempty"`
+	SetColor string `json:"set_color,omitempty"`
+	Pin      bool   `json:"pin,omitempty"`
+	Archive  bool   `json:"archive,omitempty"`
+}
+
+type NoteRuleRequest struct {
+	Name    string          `json:"name"`
+	Enabled *bool           `json:"enabled,omitempty"`
+	Match   NoteRuleMatch   `json:"match"`
+	Actions NoteRuleActions `json:"actions"`
+}
+
+type ApplyNoteRuleResult struct {
+	DryRun  bool  `json:"dry_run"`
+	NoteIDs []int `json:"note_ids"`
+}
+
 type CreateUserRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
@@ -46,13 +234,131 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// TwoFactorChallenge answers a login with the right password that still needs a second factor.
+// When EnrollmentRequired is set the user has to set up an authenticator first.
+type TwoFactorChallenge struct {
+	PendingToken       string    `json:"pending_token"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+type PendingLoginRequest struct {
+	PendingToken string `json:"pending_token"`
+}
+
+// TwoFactorLoginRequest completes a pending login with a TOTP code or a recovery code.
+type TwoFactorLoginRequest struct {
+	PendingToken string `json:"pending_token"`
+	Code         string `json:"code"`
+}
+
+// TwoFactorLoginResult is the logged in user, with their recovery codes when the login
+// completed their enrollment.
+type TwoFactorLoginResult struct {
+	User
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Settings are the server wide settings admins can change.
+type Settings struct {
+	TwoFactorRequired bool `json:"two_factor_required"`
+}
+
 type CreateNoteRequest struct {
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	Color    string `json:"color"`
-	Pinned   bool   `json:"pinned"`
-	Archived bool   `json:"archived"`
-	Order    int    `json:"order"`
+	Title      string                  `json:"title"`
+	Content    string                  `json:"content"`
+	Color      string                  `json:"color"`
+	Pinned     bool                    `json:"pinned"`
+	Archived   bool                    `json:"archived"`
+	Order      int                     `json:"order"`
+	Kind       string                  `json:"kind"`
+	Items      []CreateNoteItemRequest `json:"items,omitempty"`
+	TemplateID int                     `json:"template_id,omitempty"`
+}
+
+type NoteTemplateItem struct {
+	Text    string `json:"text"`
+	Checked bool   `json:"checked"`
+}
+
+// NoteTemplate is the starting point of new notes. Its title, content and item texts can hold
+// {{date}}, {{time}}, {{weekday}} and {{username}}, filled in when a note is created from it.
+type NoteTemplate struct {
+	ID        int                `json:"id"`
+	Name      string             `json:"name"`
+	Title     string             `json:"title"`
+	Content   string             `json:"content"`
+	Color     string             `json:"color"`
+	Kind      string             `json:"kind"`
+	Items     []NoteTemplateItem `json:"items"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+type NoteTemplateRequest struct {
+	Name    string             `json:"name"`
+	Title   string             `json:"title"`
+	Content string             `json:"content"`
+	Color   string             `json:"color"`
+	Kind    string             `json:"kind"`
+	Items   []NoteTemplateItem `json:"items,omitempty"`
+}
+
+// AccessToken is a personal access token as listed to its owner. Prefix is the start of the
+// token, enough to recognise it; the token itself is only returned when it is created.
+type AccessToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreatedAccessToken struct {
+	AccessToken
+	Token string `json:"token"`
+}
+
+// Session is a login on one device. Current marks the session the request was made with.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type RevokeSessionsResult struct {
+	Revoked int `json:"revoked"`
 }
 
 type UpdateNoteRequest struct {
@@ -64,9 +370,68 @@ type UpdateNoteRequest struct {
 	Order    *int    `json:"order,omitempty"`
 }
 
+// BulkNoteRequest applies one operation to many notes. Color goes with "color", TagID with
+// "add_tag" and "remove_tag", and Position with "move".
+type BulkNoteRequest struct {
+	NoteIDs   []int  `json:"note_ids"`
+	Operation string `json:"operation"`
+	Color     string `json:"color,omitempty"`
+	TagID     int    `json:"tag_id,omitempty"`
+	Position  *int   `json:"position,omitempty"`
+}
+
+type BulkNoteResult struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+type CreateNoteItemRequest struct {
+	Text     string `json:"text"`
+	Checked  bool   `json:"checked"`
+	Position *int   `json:"position,omitempty"`
+}
+
+type UpdateNoteItemRequest struct {
+	Text    *string `json:"text,omitempty"`
+	Checked *bool   `json:"checked,omitempty"`
+}
+
+type ToggleNoteItemRequest struct {
+	Checked bool `json:"checked"`
+}
+
+type ConvertNoteRequest struct {
+	Kind string `json:"kind"`
+}
+
+type SetReminderRequest struct {
+	RemindAt   time.Time `json:"remind_at"`
+	Recurrence string    `json:"recurrence"`
+	TimeZone   string    `json:"time_zone"`
+}
+
 type CreateTagRequest struct {
-	Name  string `json:"name"`
-	Color string `json:"color"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	ParentID *int   `json:"parent_id,omitempty"`
+}
+
+type MergeTagsRequest struct {
+	SourceIDs []int `json:"source_ids"`
+}
+
+type BulkTagRequest struct {
+	Action  string `json:"action"`
+	NoteIDs []int  `json:"note_ids,omitempty"`
+	Query   string `json:"query,omitempty"`
+}
+
+type BulkTagResult struct {
+	Updated int `json:"updated"`
+}
+
+type MoveTagRequest struct {
+	ParentID *int `json:"parent_id"`
 }
 
 type UpdateTagRequest struct {
@@ -1,8 +1,21 @@
-import type { AssignTagsToNoteRequest, CreateNoteRequest, CreateTagRequest, CreateUserRequest, LoginRequest, Note, Tag, ToggleArchiveRequest, TogglePinRequest, UpdateNoteRequest, UpdateTagRequest, User } from '~/types'
+import type { AccessToken, ApplyNoteRuleResult, AssignTagsToNoteRequest, BulkNoteRequest, BulkNoteResult, BulkTagRequest, BulkTagResult, Collection, CollectionRequest, CreateAccessTokenRequest, CreatedAccessToken, CreateNoteRequest, CreateTagRequest, CreateUserRequest, LoginRequest, Note, NoteFilter, NotePage, NoteRule, NoteRuleRequest, NoteTemplate, NoteTemplateRequest, RecoveryCodes, RevokeSessionsResult, Session, Settings, Sidebar, Tag, TagNode, TagStats, ToggleArchiveRequest, TogglePinRequest, TwoFactorChallenge, TwoFactorEnrollment, TwoFactorLoginResult, TwoFactorStatus, UpdateNoteRequest, UpdateTagRequest, User } from '~/types'
 
 const BASE_URL = '/api'
 
 class ApiClient {
+  // a refresh token can only be used once, so concurrent requests share one refresh
+  private refreshing: Promise<boolean> | null = null
+
+  private refreshSession(): Promise<boolean> {
+    this.refreshing ??= fetch(`${BASE_URL}/refresh`, { method: 'POST', credentials: 'include' })
+      .then(response => response.ok)
+      .catch(() => false)
+      .finally(() => {
+        this.refreshing = null
+      })
+    return this.refreshing
+  }
+
   private async request<T>(endpoint: string, options: RequestInit = {}): Promise<T> {
     const url = `${BASE_URL}${endpoint}`
     const config: RequestInit = {
@@ -18,7 +31,11 @@ class ApiClient {
       }
     }
 
-    const response = await fetch(url, config)
+    let response = await fetch(url, config)
+
+    // access tokens are short-lived, so refresh the session once and retry
+    if (response.status === 401 && !endpoint.startsWith('/login') && await this.refreshSession())
+      response = await fetch(url, config)
 
     if (!response.ok) {
       throw new Error(`API Error: ${response.status} ${response.statusText}`)
@@ -32,20 +49,41 @@ class ApiClient {
   }
 
   // Auth endpoints
-  async register(data: CreateUserRequest): Promise<User> {
-    return this.request<User>('/register', {
+  // register and login answer with a challenge when the user still needs a second factor
+  async register(data: CreateUserRequest): Promise<User | TwoFactorChallenge> {
+    return this.request<User | TwoFactorChallenge>('/register', {
       method: 'POST',
       body: JSON.stringify(data),
     })
   }
 
-  async login(data: LoginRequest): Promise<User> {
-    return this.request<User>('/login', {
+  async login(data: LoginRequest): Promise<User | TwoFactorChallenge> {
+    return this.request<User | TwoFactorChallenge>('/login', {
       method: 'POST',
       body: JSON.stringify(data),
     })
   }
 
+  async completeTwoFactorLogin(pendingToken: string, code: string): Promise<TwoFactorLoginResult> {
+    return this.request<TwoFactorLoginResult>('/login/2fa', {
+      method: 'POST',
+      body: JSON.stringify({ pending_token: pendingToken, code }),
+    })
+  }
+
+  async enrollPendingLogin(pendingToken: string): Promise<TwoFactorEnrollment> {
+    return this.request<TwoFactorEnrollment>('/login/2fa/enroll', {
+      method: 'POST',
+      body: JSON.stringify({ pending_token: pendingToken }),
+    })
+  }
+
+  async refresh(): Promise<User> {
+    return this.request<User>('/refresh', {
+      method: 'POST',
+    })
+  }
+
   async logout(): Promise<void> {
     return this.request<void>('/logout', {
       method: 'POST',
@@ -56,15 +94,108 @@ class ApiClient {
     return this.request<User>('/auth/check')
   }
 
+  // Access token endpoints
+  async getAccessTokens(): Promise<AccessToken[]> {
+    return this.request<AccessToken[]>('/tokens')
+  }
+
+  async createAccessToken(data: CreateAccessTokenRequest): Promise<CreatedAccessToken> {
+    return this.request<CreatedAccessToken>('/tokens', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    })
+  }
+
+  async revokeAccessToken(id: number): Promise<void> {
+    return this.request<void>(`/tokens/${id}`, {
+      method: 'DELETE',
+    })
+  }
+
+  // Session endpoints
+  async getSessions(): Promise<Session[]> {
+    return this.request<Session[]>('/sessions')
+  }
+
+  async revokeSession(id: string): Promise<void> {
+    return this.request<void>(`/sessions/${encodeURIComponent(id)}`, {
+      method: 'DELETE',
+    })
+  }
+
+  async revokeSessions(exceptCurrent = false): Promise<RevokeSessionsResult> {
+    return this.request<RevokeSessionsResult>(exceptCurrent ? '/sessions?except_current=true' : '/sessions', {
+      method: 'DELETE',
+    })
+  }
+
+  // Two-factor endpoints
+  async getTwoFactorStatus(): Promise<TwoFactorStatus> {
+    return this.request<TwoFactorStatus>('/2fa')
+  }
+
+  async enrollTwoFactor(): Promise<TwoFactorEnrollment> {
+    return this.request<TwoFactorEnrollment>('/2fa/enroll', {
+      method: 'POST',
+    })
+  }
+
+  async confirmTwoFactor(code: string): Promise<RecoveryCodes> {
+    return this.request<RecoveryCodes>('/2fa/confirm', {
+      method: 'POST',
+      body: JSON.stringify({ code }),
+    })
+  }
+
+  async disableTwoFactor(code: string): Promise<void> {
+    return this.request<void>('/2fa/disable', {
+      method: 'POST',
+      body: JSON.stringify({ code }),
+    })
+  }
+
+  async regenerateRecoveryCodes(code: string): Promise<RecoveryCodes> {
+    return this.request<RecoveryCodes>('/2fa/recovery-codes', {
+      method: 'POST',
+      body: JSON.stringify({ code }),
+    })
+  }
+
   // Note endpoints
-  async getNotes(): Promise<Note[]> {
-    return this.request<Note[]>('/notes')
+  async getNotes(filter: NoteFilter = {}): Promise<Note[]> {
+    const params = new URLSearchParams()
+    if (filter.archived)
+      params.set('archived', filter.archived)
+    if (filter.tags?.length)
+      params.set('tags', filter.tags.join(','))
+    if (filter.tags_mode)
+      params.set('tags_mode', filter.tags_mode)
+    if (filter.exclude_tags?.length)
+      params.set('exclude_tags', filter.exclude_tags.join(','))
+    if (filter.q)
+      params.set('q', filter.q)
+    const query = params.toString()
+    const page = await this.request<NotePage>(query ? `/notes?${query}` : '/notes')
+    return page.notes
   }
 
   async searchNotes(query: string): Promise<Note[]> {
     return this.request<Note[]>(`/notes/search?q=${encodeURIComponent(query)}`)
   }
 
+  async duplicateNote(id: number): Promise<Note> {
+    return this.request<Note>(`/notes/${id}/duplicate`, {
+      method: 'POST',
+    })
+  }
+
+  async bulkUpdateNotes(data: BulkNoteRequest): Promise<BulkNoteResult[]> {
+    return this.request<BulkNoteResult[]>('/notes/bulk', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    })
+  }
+
   async getNote(id: number): Promise<Note> {
     return this.request<Note>(`/notes/${id}`)
   }
@@ -111,8 +242,43 @@ class ApiClient {
   }
 
   // Tag endpoints
-  async getTags(): Promise<Tag[]> {
-    return this.request<Tag[]>('/tags')
+  async getTags(): Promise<TagStats[]> {
+    return this.request<TagStats[]>('/tags')
+  }
+
+  async getUnusedTags(): Promise<Tag[]> {
+    return this.request<Tag[]>('/tags/unused')
+  }
+
+  async deleteUnusedTags(): Promise<Tag[]> {
+    return this.request<Tag[]>('/tags/unused', {
+      method: 'DELETE',
+    })
+  }
+
+  async getTagTree(): Promise<TagNode[]> {
+    return this.request<TagNode[]>('/tags/tree')
+  }
+
+  async moveTag(id: number, parentId: number | null): Promise<Tag> {
+    return this.request<Tag>(`/tags/${id}/parent`, {
+      method: 'PUT',
+      body: JSON.stringify({ parent_id: parentId }),
+    })
+  }
+
+  async mergeTags(targetId: number, sourceIds: number[]): Promise<Tag> {
+    return this.request<Tag>(`/tags/${targetId}/merge`, {
+      method: 'POST',
+      body: JSON.stringify({ source_ids: sourceIds }),
+    })
+  }
+
+  async bulkTagNotes(id: number, data: BulkTagRequest): Promise<BulkTagResult> {
+    return this.request<BulkTagResult>(`/tags/${id}/bulk`, {
+      method: 'POST',
+      body: JSON.stringify(data),
+    })
   }
 
   async createTag(data: CreateTagRequest): Promise<Tag> {
@@ -154,6 +320,96 @@ class ApiClient {
     })
   }
 
+  // Rule endpoints
+  async getRules(): Promise<NoteRule[]> {
+    return this.request<NoteRule[]>('/rules')
+  }
+
+  async createRule(data: NoteRuleRequest): Promise<NoteRule> {
+    return this.request<NoteRule>('/rules', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    })
+  }
+
+  async updateRule(id: number, data: NoteRuleRequest): Promise<NoteRule> {
+    return this.request<NoteRule>(`/rules/${id}`, {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    })
+  }
+
+  async deleteRule(id: number): Promise<void> {
+    return this.request<void>(`/rules/${id}`, {
+      method: 'DELETE',
+    })
+  }
+
+  async applyRule(id: number, dryRun = false): Promise<ApplyNoteRuleResult> {
+    return this.request<ApplyNoteRuleResult>(`/rules/${id}/apply${dryRun ? '?dry_run=true' : ''}`, {
+      method: 'POST',
+    })
+  }
+
+  // Template endpoints
+  async getTemplates(): Promise<NoteTemplate[]> {
+    return this.request<NoteTemplate[]>('/templates')
+  }
+
+  async createTemplate(data: NoteTemplateRequest): Promise<NoteTemplate> {
+    return this.request<NoteTemplate>('/templates', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    })
+  }
+
+  async updateTemplate(id: number, data: NoteTemplateRequest): Promise<NoteTemplate> {
+    return this.request<NoteTemplate>(`/templates/${id}`, {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    })
+  }
+
+  async deleteTemplate(id: number): Promise<void> {
+    return this.request<void>(`/templates/${id}`, {
+      method: 'DELETE',
+    })
+  }
+
+  // Collection endpoints
+  async getCollections(withUnread = false): Promise<Collection[]> {
+    return this.request<Collection[]>(withUnread ? '/collections?unread=true' : '/collections')
+  }
+
+  async createCollection(data: CollectionRequest): Promise<Collection> {
+    return this.request<Collection>('/collections', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    })
+  }
+
+  async updateCollection(id: number, data: CollectionRequest): Promise<Collection> {
+    return this.request<Collection>(`/collections/${id}`, {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    })
+  }
+
+  async deleteCollection(id: number): Promise<void> {
+    return this.request<void>(`/collections/${id}`, {
+      method: 'DELETE',
+    })
+  }
+
+  async getCollectionNotes(id: number): Promise<Note[]> {
+    const page = await this.request<NotePage>(`/collections/${id}/notes`)
+    return page.notes
+  }
+
+  async getSidebar(): Promise<Sidebar> {
+    return this.request<Sidebar>('/sidebar')
+  }
+
   async uploadImage(file: File): Promise<{ url: string }> {
     const formData = new FormData()
     formData.append('image', file)
@@ -173,6 +429,33 @@ class ApiClient {
       method: 'DELETE',
     })
   }
+
+  async getUserSessions(id: number): Promise<Session[]> {
+    return this.request<Session[]>(`/users/${id}/sessions`)
+  }
+
+  async revokeUserSessions(id: number): Promise<RevokeSessionsResult> {
+    return this.request<RevokeSessionsResult>(`/users/${id}/sessions`, {
+      method: 'DELETE',
+    })
+  }
+
+  async resetUserTwoFactor(id: number): Promise<void> {
+    return this.request<void>(`/users/${id}/2fa`, {
+      method: 'DELETE',
+    })
+  }
+
+  async getSettings(): Promise<Settings> {
+    return this.request<Settings>('/settings')
+  }
+
+  async updateSettings(data: Settings): Promise<Settings> {
+    return this.request<Settings>('/settings', {
+      method: 'PUT',
+      body: JSON.stringify(data),
+    })
+  }
 }
 
 export const api = new ApiClient()
@@ -1,4 +1,4 @@
-import type { User } from '~/types'
+import type { TwoFactorChallenge, User } from '~/types'
 import { api } from '~/composables/useApi'
 
 export const useUserStore = defineStore('user', () => {
@@ -14,11 +14,16 @@ export const useUserStore = defineStore('user', () => {
     user.value = null
   }
 
+  function isChallenge(result: User | TwoFactorChallenge): result is TwoFactorChallenge {
+    return 'pending_token' in result
+  }
+
   async function register(username: string, email: string, password: string) {
     try {
-      const userData = await api.register({ username, email, password })
-      setUser(userData)
-      return userData
+      const result = await api.register({ username, email, password })
+      if (!isChallenge(result))
+        setUser(result)
+      return result
     }
     catch (error) {
       console.error('Registration failed:', error)
@@ -28,9 +33,10 @@ export const useUserStore = defineStore('user', () => {
 
   async function login(username: string, password: string) {
     try {
-      const userData = await api.login({ username, password })
-      setUser(userData)
-      return userData
+      const result = await api.login({ username, password })
+      if (!isChallenge(result))
+        setUser(result)
+      return result
     }
     catch (error) {
       console.error('Login failed:', error)
@@ -38,6 +44,12 @@ export const useUserStore = defineStore('user', () => {
     }
   }
 
+  async function completeTwoFactorLogin(pendingToken: string, code: string) {
+    const result = await api.completeTwoFactorLogin(pendingToken, code)
+    setUser(result)
+    return result
+  }
+
   async function logout() {
     try {
       await api.logout()
@@ -71,6 +83,8 @@ export const useUserStore = defineStore('user', () => {
     clearUser,
     register,
     login,
+    completeTwoFactorLogin,
+    isChallenge,
     logout,
     checkAuth,
   }
@@ -19,23 +19,79 @@ export interface Note {
   pinned: boolean
   archived: boolean
   order: number
+  version: number
+  kind: 'text' | 'checklist'
+  remind_at?: string
+  recurrence?: string
+  time_zone?: string
   tags?: Tag[]
+  items?: NoteItem[]
+  progress?: Progress
   created_at: string
   updated_at: string
 }
 
+export interface NoteItem {
+  id: number
+  note_id: number
+  text: string
+  checked: boolean
+  position: number
+  created_at: string
+  updated_at: string
+}
+
+export interface DueReminder {
+  id: number
+  note_id: number
+  title: string
+  due_at: string
+  fired_at: string
+}
+
+export interface Progress {
+  done: number
+  total: number
+}
+
+export interface NoteFilter {
+  archived?: 'true' | 'only'
+  tags?: number[]
+  tags_mode?: 'all' | 'any'
+  exclude_tags?: number[]
+  q?: string
+}
+
+export interface NotePage {
+  notes: Note[]
+  next_cursor?: string
+  total: number
+}
+
 export interface Tag {
   id: number
+  parent_id: number | null
   name: string
   color: string
   created_at: string
 }
 
+export interface TagStats extends Tag {
+  active_notes: number
+  archived_notes: number
+  last_used_at: string | null
+}
+
+export interface TagNode extends TagStats {
+  children: TagNode[]
+}
+
 export interface User {
   id: number
   username: string
   email: string
   is_admin: boolean
+  two_factor_enabled: boolean
   created_at: string
   updated_at: string
 }
@@ -58,6 +114,7 @@ export interface CreateNoteRequest {
   pinned: boolean
   archived: boolean
   order: number
+  template_id?: number
 }
 
 export interface UpdateNoteRequest {
@@ -72,6 +129,17 @@ export interface UpdateNoteRequest {
 export interface CreateTagRequest {
   name: string
   color: string
+  parent_id?: number
+}
+
+export interface BulkTagRequest {
+  action: 'add' | 'remove'
+  note_ids?: number[]
+  query?: string
+}
+
+export interface BulkTagResult {
+  updated: number
 }
 
 export interface UpdateTagRequest {
@@ -90,3 +158,182 @@ export interface TogglePinRequest {
 export interface ToggleArchiveRequest {
   archived: boolean
 }
+
+export interface NoteRuleMatch {
+  field: 'any' | 'title' | 'content'
+  type: 'substring' | 'regex'
+  pattern?: string
+  tag_id?: number
+  color?: string
+}
+
+export interface NoteRuleActions {
+  add_tag_id?: number
+  set_color?: string
+  pin?: boolean
+  archive?: boolean
+}
+
+export interface NoteRule {
+  id: number
+  name: string
+  enabled: boolean
+  match: NoteRuleMatch
+  actions: NoteRuleActions
+  created_at: string
+}
+
+export interface NoteRuleRequest {
+  name: string
+  enabled?: boolean
+  match: Partial<NoteRuleMatch>
+  actions: NoteRuleActions
+}
+
+export interface ApplyNoteRuleResult {
+  dry_run: boolean
+  note_ids: number[]
+}
+
+export interface CollectionFilters {
+  archived?: 'true' | 'only'
+  pinned?: boolean
+  color?: string
+  tags?: number[]
+  tags_mode?: 'all' | 'any'
+  exclude_tags?: number[]
+  created_within_days?: number
+  updated_within_days?: number
+}
+
+export interface Collection {
+  id: number
+  name: string
+  query: string
+  filters: CollectionFilters
+  sort?: string
+  dir?: 'asc' | 'desc'
+  last_opened_at: string | null
+  unread?: number
+  created_at: string
+  updated_at: string
+}
+
+export interface CollectionRequest {
+  name: string
+  query: string
+  filters: CollectionFilters
+  sort?: string
+  dir?: 'asc' | 'desc'
+}
+
+export interface Sidebar {
+  tags: TagNode[]
+  collections: Collection[]
+}
+
+export type BulkNoteOperation = 'archive' | 'unarchive' | 'pin' | 'unpin' | 'color' | 'delete' | 'add_tag' | 'remove_tag' | 'move'
+
+export interface BulkNoteRequest {
+  note_ids: number[]
+  operation: BulkNoteOperation
+  color?: string
+  tag_id?: number
+  position?: number
+}
+
+export interface BulkNoteResult {
+  id: number
+  status: 'updated' | 'unchanged' | 'not_found'
+}
+
+export interface NoteTemplateItem {
+  text: string
+  checked: boolean
+}
+
+export interface NoteTemplate {
+  id: number
+  name: string
+  title: string
+  content: string
+  color: string
+  kind: 'text' | 'checklist'
+  items: NoteTemplateItem[]
+  created_at: string
+  updated_at: string
+}
+
+export interface NoteTemplateRequest {
+  name: string
+  title?: string
+  content?: string
+  color?: string
+  kind?: 'text' | 'checklist'
+  items?: NoteTemplateItem[]
+}
+
+export type AccessTokenScope = 'notes:read' | 'notes:write' | 'tags:write' | 'admin'
+
+export interface AccessToken {
+  id: number
+  name: string
+  prefix: string
+  scopes: AccessTokenScope[]
+  expires_at?: string
+  last_used_at?: string
+  created_at: string
+}
+
+export interface CreateAccessTokenRequest {
+  name: string
+  scopes: AccessTokenScope[]
+  expires_at?: string
+}
+
+export interface CreatedAccessToken extends AccessToken {
+  token: string
+}
+
+export interface TwoFactorChallenge {
+  pending_token: string
+  enrollment_required: boolean
+  expires_at: string
+}
+
+export interface TwoFactorLoginResult extends User {
+  recovery_codes?: string[]
+}
+
+export interface TwoFactorEnrollment {
+  secret: string
+  uri: string
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean
+  required: boolean
+  recovery_codes_left: number
+}
+
+export interface RecoveryCodes {
+  recovery_codes: string[]
+}
+
+export interface Settings {
+  two_factor_required: boolean
+}
+
+export interface Session {
+  id: string
+  user_agent: string
+  ip: string
+  created_at: string
+  last_seen_at: string
+  expires_at: string
+  current: boolean
+}
+
+export interface RevokeSessionsResult {
+  revoked: number
+}
@@ -8,12 +8,13 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/ncruces/go-sqlite3 v0.18.3
 	github.com/rs/cors v1.11.1
+	github.com/tetratelabs/wazero v1.8.0
 	golang.org/x/crypto v0.27.0
+	golang.org/x/net v0.29.0
 )
 
 require (
 	github.com/andybalholm/brotli v1.0.6 // indirect
 	github.com/ncruces/julianday v1.0.0 // indirect
-	github.com/tetratelabs/wazero v1.8.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 )
@@ -8,10 +8,13 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// reminder time zones work on hosts without a zoneinfo database
+	_ "time/tzdata"
 
 	"dsn/core/config"
 	"dsn/core/database"
 	"dsn/core/io"
+	"dsn/core/keyring"
 	"dsn/core/services"
 )
 
@@ -28,13 +31,39 @@ func main() {
 	io.CreateDirs()
 
 	database.Initialise(ctx)
+	keyring.Initialise()
+
+	if len(os.Args) > 1 {
+		err := runCommand(ctx, os.Args[1:])
+		database.CleanShutdown()
+		if err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
 
 	authService := services.NewAuthService()
 	userService := services.NewUserService()
 	noteService := services.NewNoteService()
 	tagService := services.NewTagService()
+	revisionService := services.NewRevisionService()
+	noteItemService := services.NewNoteItemService()
+	reminderService := services.NewReminderService()
+	noteRuleService := services.NewNoteRuleService()
+	collectionService := services.NewCollectionService()
+	templateService := services.NewTemplateService()
+	twoFactorService := services.NewTwoFactorService()
+	settingsService := services.NewSettingsService()
+
+	// notes stay in the trash for the retention period, 0 keeps them until emptied
+	if config.TrashRetentionDays > 0 {
+		retention := time.Duration(config.TrashRetentionDays) * 24 * time.Hour
+		go noteService.StartTrashPurge(ctx, retention, time.Hour)
+	}
+
+	go reminderService.StartScheduler(ctx, time.Minute)
 
-	server := StartServer(userService, authService, noteService, tagService)
+	server := StartServer(userService, authService, noteService, tagService, revisionService, noteItemService, reminderService, noteRuleService, collectionService, templateService, twoFactorService, settingsService)
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
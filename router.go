@@ -33,38 +33,122 @@ func init() {
 	}
 }
 
-func StartServer(userService *services.UserService, authService *services.AuthService, noteService *services.NoteService, tagService *services.TagService) *http.Server {
+func StartServer(userService *services.UserService, authService *services.AuthService, noteService *services.NoteService, tagService *services.TagService, revisionService *services.RevisionService, noteItemService *services.NoteItemService, reminderService *services.ReminderService, noteRuleService *services.NoteRuleService, collectionService *services.CollectionService, templateService *services.TemplateService, twoFactorService *services.TwoFactorService, settingsService *services.SettingsService) *http.Server {
 	mux := http.NewServeMux()
 
 	// auth routes
-	mux.HandleFunc("POST /api/register", handlers.RegisterHandler(userService, authService))
-	mux.HandleFunc("POST /api/login", handlers.LoginHandler(userService, authService))
-	mux.HandleFunc("POST /api/logout", handlers.LogoutHandler())
+	mux.HandleFunc("POST /api/register", handlers.RegisterHandler(userService, authService, twoFactorService))
+	mux.HandleFunc("POST /api/login", handlers.LoginHandler(userService, authService, twoFactorService))
+	mux.HandleFunc("POST /api/login/2fa", handlers.TwoFactorLoginHandler(userService, authService, twoFactorService))
+	mux.HandleFunc("POST /api/login/2fa/enroll", handlers.EnrollPendingLoginHandler(twoFactorService))
+	mux.HandleFunc("POST /api/refresh", handlers.RefreshHandler(userService, authService))
+	mux.HandleFunc("POST /api/logout", handlers.LogoutHandler(authService))
 	mux.Handle("GET /api/auth/check", handlers.AuthMiddleware(authService)(http.HandlerFunc(handlers.CheckAuthHandler(userService))))
 
+	// personal access tokens are managed from a session only, so a token can't create or revoke others
+	mux.Handle("GET /api/tokens", auth.Middleware(authService)(http.HandlerFunc(handlers.GetAccessTokensHandler(authService))))
+	mux.Handle("POST /api/tokens", auth.Middleware(authService)(http.HandlerFunc(handlers.CreateAccessTokenHandler(authService))))
+	mux.Handle("DELETE /api/tokens/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.RevokeAccessTokenHandler(authService))))
+
+	// session routes
+	mux.Handle("GET /api/sessions", auth.Middleware(authService)(http.HandlerFunc(handlers.GetSessionsHandler(authService))))
+	mux.Handle("DELETE /api/sessions", auth.Middleware(authService)(http.HandlerFunc(handlers.RevokeSessionsHandler(authService))))
+	mux.Handle("DELETE /api/sessions/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.RevokeSessionHandler(authService))))
+
+	// two-factor routes
+	mux.Handle("GET /api/2fa", auth.Middleware(authService)(http.HandlerFunc(handlers.GetTwoFactorStatusHandler(twoFactorService))))
+	mux.Handle("POST /api/2fa/enroll", auth.Middleware(authService)(http.HandlerFunc(handlers.EnrollTwoFactorHandler(twoFactorService))))
+	mux.Handle("POST /api/2fa/confirm", auth.Middleware(authService)(http.HandlerFunc(handlers.ConfirmTwoFactorHandler(twoFactorService))))
+	mux.Handle("POST /api/2fa/disable", auth.Middleware(authService)(http.HandlerFunc(handlers.DisableTwoFactorHandler(twoFactorService))))
+	mux.Handle("POST /api/2fa/recovery-codes", auth.Middleware(authService)(http.HandlerFunc(handlers.RegenerateRecoveryCodesHandler(twoFactorService))))
+
 	// api routes
-	mux.Handle("GET /api/notes", auth.Middleware(authService)(http.HandlerFunc(handlers.GetNotesHandler(noteService))))
-	mux.Handle("GET /api/notes/search", auth.Middleware(authService)(http.HandlerFunc(handlers.SearchNotesHandler(noteService))))
-	mux.Handle("POST /api/notes", auth.Middleware(authService)(http.HandlerFunc(handlers.CreateNoteHandler(noteService))))
-	mux.Handle("GET /api/notes/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.GetNoteHandler(noteService))))
-	mux.Handle("PUT /api/notes/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.UpdateNoteHandler(noteService))))
-	mux.Handle("PATCH /api/notes/{id}/pin", auth.Middleware(authService)(http.HandlerFunc(handlers.TogglePinHandler(noteService))))
-	mux.Handle("PATCH /api/notes/{id}/archive", auth.Middleware(authService)(http.HandlerFunc(handlers.ToggleArchiveHandler(noteService))))
-	mux.Handle("PUT /api/notes/order", auth.Middleware(authService)(http.HandlerFunc(handlers.UpdateNotesOrderHandler(noteService))))
-	mux.Handle("DELETE /api/notes/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.DeleteNoteHandler(noteService))))
+	mux.Handle("GET /api/notes", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetNotesHandler(noteService))))
+	mux.Handle("GET /api/notes/search", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.SearchNotesHandler(noteService))))
+	mux.Handle("POST /api/notes", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.CreateNoteHandler(noteService))))
+	mux.Handle("GET /api/notes/{id}", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetNoteHandler(noteService))))
+	mux.Handle("PUT /api/notes/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.UpdateNoteHandler(noteService))))
+	mux.Handle("PATCH /api/notes/{id}/pin", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.TogglePinHandler(noteService))))
+	mux.Handle("PATCH /api/notes/{id}/archive", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.ToggleArchiveHandler(noteService))))
+	mux.Handle("POST /api/notes/bulk", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.BulkNotesHandler(noteService))))
+	mux.Handle("PUT /api/notes/order", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.UpdateNotesOrderHandler(noteService))))
+	mux.Handle("DELETE /api/notes/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DeleteNoteHandler(noteService))))
+	mux.Handle("POST /api/notes/{id}/duplicate", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DuplicateNoteHandler(noteService))))
+	mux.Handle("POST /api/notes/{id}/restore", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.RestoreNoteHandler(noteService))))
+
+	mux.Handle("POST /api/notes/{id}/convert", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.ConvertNoteHandler(noteService))))
+
+	// checklist item routes
+	mux.Handle("POST /api/notes/{id}/items", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.CreateNoteItemHandler(noteItemService))))
+	mux.Handle("PUT /api/notes/{id}/items/order", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.UpdateNoteItemsOrderHandler(noteItemService))))
+	mux.Handle("PUT /api/notes/{id}/items/{itemId}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.UpdateNoteItemHandler(noteItemService))))
+	mux.Handle("PATCH /api/notes/{id}/items/{itemId}/check", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.ToggleNoteItemHandler(noteItemService))))
+	mux.Handle("DELETE /api/notes/{id}/items/{itemId}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DeleteNoteItemHandler(noteItemService))))
+
+	// reminder routes
+	mux.Handle("PUT /api/notes/{id}/reminder", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.SetNoteReminderHandler(noteService))))
+	mux.Handle("DELETE /api/notes/{id}/reminder", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.ClearNoteReminderHandler(noteService))))
+	mux.Handle("GET /api/reminders/upcoming", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetUpcomingRemindersHandler(noteService))))
+	mux.Handle("GET /api/reminders/due", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetDueRemindersHandler(reminderService))))
+	mux.Handle("DELETE /api/reminders/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DismissReminderHandler(reminderService))))
+
+	// revision routes
+	mux.Handle("GET /api/notes/{id}/revisions", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetNoteRevisionsHandler(revisionService))))
+	mux.Handle("GET /api/notes/{id}/revisions/diff", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.DiffNoteRevisionsHandler(revisionService))))
+	mux.Handle("GET /api/notes/{id}/revisions/{rev}", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetNoteRevisionHandler(revisionService))))
+	mux.Handle("POST /api/notes/{id}/revisions/{rev}/restore", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.RestoreNoteRevisionHandler(revisionService, noteService))))
+
+	// trash routes
+	mux.Handle("GET /api/trash", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetTrashHandler(noteService))))
+	mux.Handle("DELETE /api/trash", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.EmptyTrashHandler(noteService))))
+	mux.Handle("DELETE /api/trash/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DeleteNotePermanentlyHandler(noteService))))
 
 	// tag routes
-	mux.Handle("GET /api/tags", auth.Middleware(authService)(http.HandlerFunc(handlers.GetTagsHandler(tagService))))
-	mux.Handle("POST /api/tags", auth.Middleware(authService)(http.HandlerFunc(handlers.CreateTagHandler(tagService))))
-	mux.Handle("PUT /api/tags/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.UpdateTagHandler(tagService))))
-	mux.Handle("DELETE /api/tags/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.DeleteTagHandler(tagService))))
-	mux.Handle("POST /api/notes/{noteId}/tags/{tagId}", auth.Middleware(authService)(http.HandlerFunc(handlers.AssignTagToNoteHandler(tagService))))
-	mux.Handle("DELETE /api/notes/{noteId}/tags/{tagId}", auth.Middleware(authService)(http.HandlerFunc(handlers.RemoveTagFromNoteHandler(tagService))))
-	mux.Handle("PUT /api/notes/{id}/tags", auth.Middleware(authService)(http.HandlerFunc(handlers.SetNoteTagsHandler(tagService))))
+	mux.Handle("GET /api/tags", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetTagsHandler(tagService))))
+	mux.Handle("GET /api/tags/tree", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetTagTreeHandler(tagService))))
+	mux.Handle("GET /api/tags/unused", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetUnusedTagsHandler(tagService))))
+	mux.Handle("DELETE /api/tags/unused", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.DeleteUnusedTagsHandler(tagService))))
+	mux.Handle("POST /api/tags", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.CreateTagHandler(tagService))))
+	mux.Handle("PUT /api/tags/{id}", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.UpdateTagHandler(tagService))))
+	mux.Handle("PUT /api/tags/{id}/parent", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.MoveTagHandler(tagService))))
+	mux.Handle("POST /api/tags/{id}/merge", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.MergeTagsHandler(tagService))))
+	mux.Handle("POST /api/tags/{id}/bulk", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.BulkTagNotesHandler(tagService))))
+	mux.Handle("DELETE /api/tags/{id}", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.DeleteTagHandler(tagService))))
+	mux.Handle("POST /api/notes/{noteId}/tags/{tagId}", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.AssignTagToNoteHandler(tagService))))
+	mux.Handle("DELETE /api/notes/{noteId}/tags/{tagId}", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.RemoveTagFromNoteHandler(tagService))))
+	mux.Handle("PUT /api/notes/{id}/tags", auth.Middleware(authService, services.ScopeTagsWrite)(http.HandlerFunc(handlers.SetNoteTagsHandler(tagService))))
+
+	// rule routes
+	mux.Handle("GET /api/rules", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetNoteRulesHandler(noteRuleService))))
+	mux.Handle("POST /api/rules", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.CreateNoteRuleHandler(noteRuleService))))
+	mux.Handle("PUT /api/rules/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.UpdateNoteRuleHandler(noteRuleService))))
+	mux.Handle("DELETE /api/rules/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DeleteNoteRuleHandler(noteRuleService))))
+	mux.Handle("POST /api/rules/{id}/apply", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.ApplyNoteRuleHandler(noteRuleService))))
+
+	// collection routes
+	mux.Handle("GET /api/collections", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetCollectionsHandler(collectionService))))
+	mux.Handle("POST /api/collections", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.CreateCollectionHandler(collectionService))))
+	mux.Handle("GET /api/collections/{id}", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetCollectionHandler(collectionService))))
+	mux.Handle("PUT /api/collections/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.UpdateCollectionHandler(collectionService))))
+	mux.Handle("DELETE /api/collections/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DeleteCollectionHandler(collectionService))))
+	mux.Handle("GET /api/collections/{id}/notes", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetCollectionNotesHandler(collectionService, noteService))))
+	mux.Handle("GET /api/sidebar", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetSidebarHandler(tagService, collectionService))))
+
+	// template routes
+	mux.Handle("GET /api/templates", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetTemplatesHandler(templateService))))
+	mux.Handle("POST /api/templates", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.CreateTemplateHandler(templateService))))
+	mux.Handle("GET /api/templates/{id}", auth.Middleware(authService, services.ScopeNotesRead)(http.HandlerFunc(handlers.GetTemplateHandler(templateService))))
+	mux.Handle("PUT /api/templates/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.UpdateTemplateHandler(templateService))))
+	mux.Handle("DELETE /api/templates/{id}", auth.Middleware(authService, services.ScopeNotesWrite)(http.HandlerFunc(handlers.DeleteTemplateHandler(templateService))))
 
 	// admin routes
-	mux.Handle("GET /api/users", auth.Middleware(authService)(http.HandlerFunc(handlers.GetUsersHandler(userService))))
-	mux.Handle("DELETE /api/users/{id}", auth.Middleware(authService)(http.HandlerFunc(handlers.DeleteUserHandler(userService))))
+	mux.Handle("GET /api/users", auth.Middleware(authService, services.ScopeAdmin)(http.HandlerFunc(handlers.GetUsersHandler(userService))))
+	mux.Handle("DELETE /api/users/{id}", auth.Middleware(authService, services.ScopeAdmin)(http.HandlerFunc(handlers.DeleteUserHandler(userService))))
+	mux.Handle("GET /api/users/{id}/sessions", auth.Middleware(authService, services.ScopeAdmin)(http.HandlerFunc(handlers.GetUserSessionsHandler(authService))))
+	mux.Handle("DELETE /api/users/{id}/sessions", auth.Middleware(authService, services.ScopeAdmin)(http.HandlerFunc(handlers.RevokeUserSessionsHandler(authService))))
+	mux.Handle("DELETE /api/users/{id}/2fa", auth.Middleware(authService, services.ScopeAdmin)(http.HandlerFunc(handlers.ResetUserTwoFactorHandler(twoFactorService))))
+	mux.Handle("GET /api/settings", auth.Middleware(authService, services.ScopeAdmin)(http.HandlerFunc(handlers.GetSettingsHandler(settingsService))))
+	mux.Handle("PUT /api/settings", auth.Middleware(authService, services.ScopeAdmin)(http.HandlerFunc(handlers.UpdateSettingsHandler(settingsService))))
 
 	// Serve uploaded files
 	uploadsDir := filepath.Join(config.DataDirectoryPath, "uploads")
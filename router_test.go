@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dsn/core/config"
+	"dsn/core/database"
+	dsnio "dsn/core/io"
+	"dsn/core/keyring"
+	"dsn/core/logic"
+	"dsn/core/services"
+	"dsn/core/types"
+
+	"github.com/ncruces/go-sqlite3"
+	"github.com/tetratelabs/wazero"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "dsn-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// compiling SQLite takes longer than the tests themselves, the interpreter starts at once
+	sqlite3.RuntimeConfig = wazero.NewRuntimeConfigInterpreter()
+	log.SetOutput(io.Discard)
+	config.DataDirectoryPath = dir
+	config.DatabaseDirectory = filepath.Join(dir, "database")
+	config.UploadsDirectory = filepath.Join(dir, "uploads")
+	config.KeysDirectory = filepath.Join(dir, "keys")
+	config.JwtAlgorithm = keyring.AlgorithmHS256
+	dsnio.CreateDirs()
+	database.Initialise(context.Background())
+	keyring.Initialise()
+
+	code := m.Run()
+
+	database.CleanShutdown()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newTestHandler() http.Handler {
+	server := StartServer(services.NewUserService(), services.NewAuthService(), services.NewNoteService(), services.NewTagService(),
+		services.NewRevisionService(), services.NewNoteItemService(), services.NewReminderService(), services.NewNoteRuleService(),
+		services.NewCollectionService(), services.NewTemplateService(), services.NewTwoFactorService(), services.NewSettingsService())
+	return server.Handler
+}
+
+// testClient sends requests to the router as a logged in user.
+type testClient struct {
+	t       *testing.T
+	handler http.Handler
+	cookies []*http.Cookie
+}
+
+func register(t *testing.T, handler http.Handler, username string) *testClient {
+	t.Helper()
+	c := &testClient{t: t, handler: handler}
+	res := c.do("POST", "/api/register", types.CreateUserRequest{Username: username, Email: username + "@example.com", Password: "password"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("register %s: %d %s", username, res.Code, res.Body)
+	}
+	c.cookies = res.Result().Cookies()
+	return c
+}
+
+func (c *testClient) do(method, path string, body any) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+
+	res := httptest.NewRecorder()
+	c.handler.ServeHTTP(res, req)
+	return res
+}
+
+// decode sends a request that must succeed and decodes its answer into out.
+func (c *testClient) decode(method, path string, body, out any) {
+	c.t.Helper()
+	res := c.do(method, path, body)
+	if res.Code >= 300 {
+		c.t.Fatalf("%s %s: %d %s", method, path, res.Code, res.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(res.Body.Bytes(), out); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+// ownerFixture is everything user A owns that user B then tries to reach.
+type ownerFixture struct {
+	user, note, checklist, trashed, item, tag, reminder, revision, rule, collection, template, token int
+
+	session, totpCode string
+}
+
+// secret is part of the name of everything user A creates, so it shows when it leaks to B.
+const secret = "alpha-secret"
+
+func createOwnerFixture(t *testing.T, a *testClient) ownerFixture {
+	t.Helper()
+	var f ownerFixture
+
+	var tag types.Tag
+	a.decode("POST", "/api/tags", types.CreateTagRequest{Name: secret + " tag"}, &tag)
+	f.tag = tag.ID
+
+	var note types.Note
+	a.decode("POST", "/api/notes", types.CreateNoteRequest{Title: secret + " note", Content: "first"}, &note)
+	f.note = note.ID
+	a.decode("POST", fmt.Sprintf("/api/notes/%d/tags/%d", f.note, f.tag), nil, nil)
+	title := secret + " note edited"
+	a.decode("PUT", fmt.Sprintf("/api/notes/%d", f.note), types.UpdateNoteRequest{Title: &title}, nil)
+
+	var revisions []types.NoteRevision
+	a.decode("GET", fmt.Sprintf("/api/notes/%d/revisions", f.note), nil, &revisions)
+	if len(revisions) == 0 {
+		t.Fatal("expected a revision")
+	}
+	f.revision = revisions[0].Revision
+
+	var checklist types.Note
+	a.decode("POST", "/api/notes", types.CreateNoteRequest{Title: secret + " list", Kind: types.NoteKindChecklist,
+		Items: []types.CreateNoteItemRequest{{Text: secret + " item"}}}, &checklist)
+	f.checklist = checklist.ID
+	f.item = checklist.Items[0].ID
+
+	a.decode("PUT", fmt.Sprintf("/api/notes/%d/reminder", f.checklist), types.SetReminderRequest{RemindAt: time.Now().Add(-time.Minute)}, nil)
+	if _, err := services.NewReminderService().FireDue(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var due []types.DueReminder
+	a.decode("GET", "/api/reminders/due", nil, &due)
+	if len(due) == 0 {
+		t.Fatal("expected a due reminder")
+	}
+	f.reminder = due[0].ID
+	a.decode("PUT", fmt.Sprintf("/api/notes/%d/reminder", f.checklist), types.SetReminderRequest{RemindAt: time.Now().Add(time.Hour)}, nil)
+
+	var trashed types.Note
+	a.decode("POST", "/api/notes", types.CreateNoteRequest{Title: secret + " trashed"}, &trashed)
+	f.trashed = trashed.ID
+	a.decode("DELETE", fmt.Sprintf("/api/notes/%d", f.trashed), nil, nil)
+
+	var rule types.NoteRule
+	a.decode("POST", "/api/rules", types.NoteRuleRequest{Name: secret + " rule", Match: types.NoteRuleMatch{Pattern: "x"},
+		Actions: types.NoteRuleActions{SetColor: "red"}}, &rule)
+	f.rule = rule.ID
+
+	var collection types.Collection
+	a.decode("POST", "/api/collections", types.CollectionRequest{Name: secret + " collection", Query: secret}, &collection)
+	f.collection = collection.ID
+
+	var template types.NoteTemplate
+	a.decode("POST", "/api/templates", types.NoteTemplateRequest{Name: secret + " template", Title: secret}, &template)
+	f.template = template.ID
+
+	var user types.User
+	a.decode("GET", "/api/auth/check", nil, &user)
+	f.user = user.ID
+
+	var sessions []types.Session
+	a.decode("GET", "/api/sessions", nil, &sessions)
+	for _, session := range sessions {
+		if session.Current {
+			f.session = session.ID
+		}
+	}
+	if f.session == "" {
+		t.Fatal("expected a current session")
+	}
+
+	var token types.CreatedAccessToken
+	a.decode("POST", "/api/tokens", types.CreateAccessTokenRequest{Name: secret + " token", Scopes: []string{services.ScopeNotesRead}}, &token)
+	f.token = token.ID
+
+	var enrollment types.TwoFactorEnrollment
+	a.decode("POST", "/api/2fa/enroll", nil, &enrollment)
+	code, err := logic.TOTPCode(enrollment.Secret, logic.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.totpCode = code
+	a.decode("POST", "/api/2fa/confirm", types.TwoFactorCodeRequest{Code: code}, nil)
+
+	return f
+}
+
+// crossUserRoute is a request by user B naming something of user A's.
+type crossUserRoute struct {
+	pattern string
+	path    string
+	body    any
+}
+
+func crossUserRoutes(f ownerFixture, ownTag, ownNote int) []crossUserRoute {
+	title := "taken"
+	checked := true
+	return []crossUserRoute{
+		{"GET /api/notes/{id}", fmt.Sprintf("/api/notes/%d", f.note), nil},
+		{"PUT /api/notes/{id}", fmt.Sprintf("/api/notes/%d", f.note), types.UpdateNoteRequest{Title: &title}},
+		{"PATCH /api/notes/{id}/pin", fmt.Sprintf("/api/notes/%d/pin", f.note), types.TogglePinRequest{Pinned: true}},
+		{"PATCH /api/notes/{id}/archive", fmt.Sprintf("/api/notes/%d/archive", f.note), types.ToggleArchiveRequest{Archived: true}},
+		{"DELETE /api/notes/{id}", fmt.Sprintf("/api/notes/%d", f.note), nil},
+		{"POST /api/notes/{id}/duplicate", fmt.Sprintf("/api/notes/%d/duplicate", f.note), nil},
+		{"POST /api/notes/{id}/restore", fmt.Sprintf("/api/notes/%d/restore", f.trashed), nil},
+		{"POST /api/notes/{id}/convert", fmt.Sprintf("/api/notes/%d/convert", f.note), types.ConvertNoteRequest{Kind: types.NoteKindChecklist}},
+
+		{"POST /api/notes/{id}/items", fmt.Sprintf("/api/notes/%d/items", f.checklist), types.CreateNoteItemRequest{Text: title}},
+		{"PUT /api/notes/{id}/items/order", fmt.Sprintf("/api/notes/%d/items/order", f.checklist), map[int]int{f.item: 5}},
+		{"PUT /api/notes/{id}/items/{itemId}", fmt.Sprintf("/api/notes/%d/items/%d", f.checklist, f.item), types.UpdateNoteItemRequest{Text: &title}},
+		{"PATCH /api/notes/{id}/items/{itemId}/check", fmt.Sprintf("/api/notes/%d/items/%d/check", f.checklist, f.item), types.ToggleNoteItemRequest{Checked: checked}},
+		{"DELETE /api/notes/{id}/items/{itemId}", fmt.Sprintf("/api/notes/%d/items/%d", f.checklist, f.item), nil},
+
+		{"PUT /api/notes/{id}/reminder", fmt.Sprintf("/api/notes/%d/reminder", f.note), types.SetReminderRequest{RemindAt: time.Now().Add(time.Hour)}},
+		{"DELETE /api/notes/{id}/reminder", fmt.Sprintf("/api/notes/%d/reminder", f.checklist), nil},
+		{"DELETE /api/reminders/{id}", fmt.Sprintf("/api/reminders/%d", f.reminder), nil},
+
+		{"GET /api/notes/{id}/revisions", fmt.Sprintf("/api/notes/%d/revisions", f.note), nil},
+		{"GET /api/notes/{id}/revisions/diff", fmt.Sprintf("/api/notes/%d/revisions/diff?from=%d&to=%d", f.note, f.revision, f.revision), nil},
+		{"GET /api/notes/{id}/revisions/{rev}", fmt.Sprintf("/api/notes/%d/revisions/%d", f.note, f.revision), nil},
+		{"POST /api/notes/{id}/revisions/{rev}/restore", fmt.Sprintf("/api/notes/%d/revisions/%d/restore", f.note, f.revision), nil},
+
+		{"DELETE /api/trash/{id}", fmt.Sprintf("/api/trash/%d", f.trashed), nil},
+
+		{"PUT /api/tags/{id}", fmt.Sprintf("/api/tags/%d", f.tag), types.UpdateTagRequest{Name: &title}},
+		{"PUT /api/tags/{id}/parent", fmt.Sprintf("/api/tags/%d/parent", f.tag), types.MoveTagRequest{ParentID: &ownTag}},
+		{"POST /api/tags/{id}/merge", fmt.Sprintf("/api/tags/%d/merge", f.tag), types.MergeTagsRequest{SourceIDs: []int{ownTag}}},
+		{"POST /api/tags/{id}/merge", fmt.Sprintf("/api/tags/%d/merge", ownTag), types.MergeTagsRequest{SourceIDs: []int{f.tag}}},
+		{"POST /api/tags/{id}/bulk", fmt.Sprintf("/api/tags/%d/bulk", f.tag), types.BulkTagRequest{Action: services.BulkTagAdd, NoteIDs: []int{ownNote}}},
+		{"POST /api/tags/{id}/bulk", fmt.Sprintf("/api/tags/%d/bulk", ownTag), types.BulkTagRequest{Action: services.BulkTagAdd, NoteIDs: []int{f.note}}},
+		{"DELETE /api/tags/{id}", fmt.Sprintf("/api/tags/%d", f.tag), nil},
+		{"POST /api/notes/{noteId}/tags/{tagId}", fmt.Sprintf("/api/notes/%d/tags/%d", f.note, ownTag), nil},
+		{"POST /api/notes/{noteId}/tags/{tagId}", fmt.Sprintf("/api/notes/%d/tags/%d", ownNote, f.tag), nil},
+		{"DELETE /api/notes/{noteId}/tags/{tagId}", fmt.Sprintf("/api/notes/%d/tags/%d", f.note, f.tag), nil},
+		{"PUT /api/notes/{id}/tags", fmt.Sprintf("/api/notes/%d/tags", f.note), types.AssignTagsToNoteRequest{TagIDs: []int{ownTag}}},
+		{"PUT /api/notes/{id}/tags", fmt.Sprintf("/api/notes/%d/tags", ownNote), types.AssignTagsToNoteRequest{TagIDs: []int{f.tag}}},
+
+		{"PUT /api/rules/{id}", fmt.Sprintf("/api/rules/%d", f.rule), types.NoteRuleRequest{Name: title, Match: types.NoteRuleMatch{Pattern: "x"}, Actions: types.NoteRuleActions{Pin: true}}},
+		{"DELETE /api/rules/{id}", fmt.Sprintf("/api/rules/%d", f.rule), nil},
+		{"POST /api/rules/{id}/apply", fmt.Sprintf("/api/rules/%d/apply", f.rule), nil},
+
+		{"GET /api/collections/{id}", fmt.Sprintf("/api/collections/%d", f.collection), nil},
+		{"PUT /api/collections/{id}", fmt.Sprintf("/api/collections/%d", f.collection), types.CollectionRequest{Name: title}},
+		{"DELETE /api/collections/{id}", fmt.Sprintf("/api/collections/%d", f.collection), nil},
+		{"GET /api/collections/{id}/notes", fmt.Sprintf("/api/collections/%d/notes", f.collection), nil},
+
+		{"GET /api/templates/{id}", fmt.Sprintf("/api/templates/%d", f.template), nil},
+		{"PUT /api/templates/{id}", fmt.Sprintf("/api/templates/%d", f.template), types.NoteTemplateRequest{Name: title}},
+		{"DELETE /api/templates/{id}", fmt.Sprintf("/api/templates/%d", f.template), nil},
+
+		{"DELETE /api/sessions/{id}", "/api/sessions/" + f.session, nil},
+		{"DELETE /api/tokens/{id}", fmt.Sprintf("/api/tokens/%d", f.token), nil},
+	}
+}
+
+// callerRoute is a request by user B answered with want rather than a 404, as it acts on B's own
+// account whatever it is sent, or needs an admin, which B is not.
+type callerRoute struct {
+	crossUserRoute
+	want int
+}
+
+func callerRoutes(f ownerFixture) []callerRoute {
+	route := func(pattern, path string, body any, want int) callerRoute {
+		return callerRoute{crossUserRoute{pattern, path, body}, want}
+	}
+	code := types.TwoFactorCodeRequest{Code: f.totpCode}
+	return []callerRoute{
+		route("DELETE /api/sessions", "/api/sessions?except_current=true", nil, http.StatusOK),
+
+		// the two-factor routes act on the caller, so A's code means nothing to B's account
+		route("POST /api/2fa/disable", "/api/2fa/disable", code, http.StatusConflict),
+		route("POST /api/2fa/recovery-codes", "/api/2fa/recovery-codes", code, http.StatusConflict),
+		route("POST /api/2fa/enroll", "/api/2fa/enroll", nil, http.StatusOK),
+		route("POST /api/2fa/confirm", "/api/2fa/confirm", code, http.StatusBadRequest),
+
+		// A registered first and is the admin, B is not
+		route("GET /api/users", "/api/users", nil, http.StatusForbidden),
+		route("DELETE /api/users/{id}", fmt.Sprintf("/api/users/%d", f.user), nil, http.StatusForbidden),
+		route("GET /api/users/{id}/sessions", fmt.Sprintf("/api/users/%d/sessions", f.user), nil, http.StatusForbidden),
+		route("DELETE /api/users/{id}/sessions", fmt.Sprintf("/api/users/%d/sessions", f.user), nil, http.StatusForbidden),
+		route("DELETE /api/users/{id}/2fa", fmt.Sprintf("/api/users/%d/2fa", f.user), nil, http.StatusForbidden),
+		route("GET /api/settings", "/api/settings", nil, http.StatusForbidden),
+		route("PUT /api/settings", "/api/settings", map[string]any{"require_two_factor": true}, http.StatusForbidden),
+	}
+}
+
+// listRoutes answer with the user's own things only, so user A's must not show up in them.
+var listRoutes = []string{
+	"GET /api/notes",
+	"GET /api/notes/search?q=" + secret,
+	"GET /api/trash",
+	"GET /api/reminders/upcoming",
+	"GET /api/reminders/due",
+	"GET /api/tags",
+	"GET /api/tags/tree",
+	"GET /api/tags/unused",
+	"GET /api/rules",
+	"GET /api/collections",
+	"GET /api/sidebar",
+	"GET /api/templates",
+	"GET /api/tokens",
+	"GET /api/sessions",
+	"GET /api/2fa",
+}
+
+// ownRoutes act only on the user's own things and name nothing of anyone else's.
+var ownRoutes = []string{
+	"POST /api/notes",
+	"PUT /api/notes/order",
+	"DELETE /api/trash",
+	"DELETE /api/tags/unused",
+	"POST /api/tags",
+	"POST /api/rules",
+	"POST /api/collections",
+	"POST /api/templates",
+	"POST /api/tokens",
+}
+
+// exemptRoutes are not tested across users, each for the reason given.
+var exemptRoutes = map[string]string{
+	"POST /api/register":         "creates a new user and names no one else",
+	"POST /api/login":            "authenticates by username and password, not by a session",
+	"POST /api/login/2fa":        "completes a login by its pending token, not by a session",
+	"POST /api/login/2fa/enroll": "enrolls the user of a pending login, not of a session",
+	"POST /api/refresh":          "rotates the refresh token it is sent, covered by the session service tests",
+	"POST /api/logout":           "ends the session it is sent with",
+	"GET /api/auth/check":        "answers the caller's own user",
+	"POST /api/upload/image":     "uploads belong to no user, an image is served to anyone with its URL",
+}
+
+func TestCrossUserAccess(t *testing.T) {
+	handler := newTestHandler()
+	a := register(t, handler, "owner")
+	b := register(t, handler, "intruder")
+
+	f := createOwnerFixture(t, a)
+
+	var ownTag types.Tag
+	b.decode("POST", "/api/tags", types.CreateTagRequest{Name: "own tag"}, &ownTag)
+	var ownNote types.Note
+	b.decode("POST", "/api/notes", types.CreateNoteRequest{Title: "own note"}, &ownNote)
+
+	var before types.Note
+	a.decode("GET", fmt.Sprintf("/api/notes/%d", f.note), nil, &before)
+
+	routes := crossUserRoutes(f, ownTag.ID, ownNote.ID)
+	for _, route := range routes {
+		method, _, _ := strings.Cut(route.pattern, " ")
+		t.Run(route.pattern+" "+route.path, func(t *testing.T) {
+			res := b.do(method, route.path, route.body)
+			if res.Code != http.StatusNotFound {
+				t.Errorf("got %d %s, want 404", res.Code, strings.TrimSpace(res.Body.String()))
+			}
+		})
+	}
+
+	callers := callerRoutes(f)
+	for _, route := range callers {
+		method, _, _ := strings.Cut(route.pattern, " ")
+		t.Run(route.pattern+" "+route.path, func(t *testing.T) {
+			res := b.do(method, route.path, route.body)
+			if res.Code != route.want {
+				t.Errorf("got %d %s, want %d", res.Code, strings.TrimSpace(res.Body.String()), route.want)
+			}
+		})
+	}
+
+	// bulk operations report each note on its own, so A's note is not found among B's
+	t.Run("POST /api/notes/bulk", func(t *testing.T) {
+		var results []types.BulkNoteResult
+		b.decode("POST", "/api/notes/bulk", types.BulkNoteRequest{NoteIDs: []int{f.note}, Operation: "pin"}, &results)
+		if len(results) != 1 || results[0].Status != services.BulkStatusNotFound {
+			t.Errorf("got %+v, want a not_found result", results)
+		}
+	})
+
+	// B reordering A's notes is a no-op rather than a 404, as the order is a map of ids
+	b.do("PUT", "/api/notes/order", map[int]int{f.note: 99})
+
+	for _, route := range listRoutes {
+		method, path, _ := strings.Cut(route, " ")
+		t.Run(route, func(t *testing.T) {
+			res := b.do(method, path, nil)
+			if res.Code != http.StatusOK {
+				t.Fatalf("got %d %s", res.Code, res.Body)
+			}
+			if strings.Contains(res.Body.String(), secret) || strings.Contains(res.Body.String(), f.session) {
+				t.Errorf("leaks user A's data: %s", res.Body)
+			}
+		})
+	}
+
+	t.Run("two-factor status is the caller's", func(t *testing.T) {
+		var status types.TwoFactorStatus
+		b.decode("GET", "/api/2fa", nil, &status)
+		if status.Enabled || status.RecoveryCodesLeft != 0 {
+			t.Errorf("B sees A's two-factor status: %+v", status)
+		}
+	})
+
+	t.Run("owner's data is untouched", func(t *testing.T) {
+		var after types.Note
+		a.decode("GET", fmt.Sprintf("/api/notes/%d", f.note), nil, &after)
+		if after.Title != before.Title || after.Version != before.Version || after.Pinned || after.Archived ||
+			after.Order != before.Order || len(after.Tags) != 1 || after.Tags[0].ID != f.tag {
+			t.Errorf("note changed from %+v to %+v", before, after)
+		}
+
+		var checklist types.Note
+		a.decode("GET", fmt.Sprintf("/api/notes/%d", f.checklist), nil, &checklist)
+		if len(checklist.Items) != 1 || checklist.Items[0].Text != secret+" item" || checklist.Items[0].Checked || checklist.RemindAt == nil {
+			t.Errorf("checklist changed: %+v", checklist)
+		}
+
+		for _, path := range []string{
+			fmt.Sprintf("/api/rules/%d/apply?dry_run=true", f.rule),
+			fmt.Sprintf("/api/collections/%d", f.collection),
+			fmt.Sprintf("/api/templates/%d", f.template),
+			fmt.Sprintf("/api/notes/%d/revisions/%d", f.note, f.revision),
+		} {
+			method := "GET"
+			if strings.Contains(path, "/apply") {
+				method = "POST"
+			}
+			if res := a.do(method, path, nil); res.Code != http.StatusOK {
+				t.Errorf("%s %s: got %d", method, path, res.Code)
+			}
+		}
+
+		var tags []types.Tag
+		a.decode("GET", "/api/tags", nil, &tags)
+		if len(tags) != 1 || tags[0].Name != secret+" tag" {
+			t.Errorf("tags changed: %+v", tags)
+		}
+
+		var trash []types.Note
+		a.decode("GET", "/api/trash", nil, &trash)
+		if len(trash) != 1 || trash[0].ID != f.trashed {
+			t.Errorf("trash changed: %+v", trash)
+		}
+
+		var due []types.DueReminder
+		a.decode("GET", "/api/reminders/due", nil, &due)
+		if len(due) != 1 {
+			t.Errorf("reminder dismissed: %+v", due)
+		}
+
+		var sessions []types.Session
+		a.decode("GET", "/api/sessions", nil, &sessions)
+		if !slices.ContainsFunc(sessions, func(session types.Session) bool { return session.ID == f.session }) {
+			t.Errorf("session revoked: %+v", sessions)
+		}
+
+		var tokens []types.AccessToken
+		a.decode("GET", "/api/tokens", nil, &tokens)
+		if len(tokens) != 1 || tokens[0].ID != f.token {
+			t.Errorf("tokens changed: %+v", tokens)
+		}
+
+		var status types.TwoFactorStatus
+		a.decode("GET", "/api/2fa", nil, &status)
+		if !status.Enabled || status.RecoveryCodesLeft == 0 {
+			t.Errorf("two-factor status changed: %+v", status)
+		}
+
+		var users []types.User
+		if res := a.do("GET", "/api/users", nil); res.Code != http.StatusOK || json.Unmarshal(res.Body.Bytes(), &users) != nil || len(users) != 2 {
+			t.Errorf("users changed: %d %s", res.Code, res.Body)
+		}
+	})
+
+	t.Run("every route is covered", func(t *testing.T) {
+		covered := map[string]bool{"POST /api/notes/bulk": true}
+		for _, route := range routes {
+			covered[route.pattern] = true
+		}
+		for _, route := range callers {
+			covered[route.pattern] = true
+		}
+		for _, route := range append(listRoutes, ownRoutes...) {
+			pattern, _, _ := strings.Cut(route, "?")
+			covered[pattern] = true
+		}
+
+		for pattern := range exemptRoutes {
+			covered[pattern] = true
+		}
+
+		for _, pattern := range routerPatterns(t) {
+			if !covered[pattern] {
+				t.Errorf("route %q is neither covered by the cross-user test nor exempt", pattern)
+			}
+		}
+	})
+}
+
+var apiRoute = regexp.MustCompile(`^(\S+ )?/api/`)
+
+// routerPatterns returns the patterns of the API routes in router.go.
+func routerPatterns(t *testing.T) []string {
+	t.Helper()
+	source, err := os.ReadFile("router.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patterns []string
+	for _, match := range regexp.MustCompile(`mux\.Handle(?:Func)?\("([^"]+)"`).FindAllStringSubmatch(string(source), -1) {
+		if apiRoute.MatchString(match[1]) {
+			patterns = append(patterns, match[1])
+		}
+	}
+	if len(patterns) == 0 {
+		t.Fatal("no routes found in router.go")
+	}
+	return patterns
+}